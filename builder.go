@@ -0,0 +1,442 @@
+package godo
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/godo.v2/util"
+)
+
+// CommandBuilder configures a command. Create one with Command, CommandArgv
+// or BashCommand.
+//
+//		result, err := do.Command("go test ./...").
+//			Dir("pkg").
+//			Env("CGO_ENABLED=0").
+//			Capture().
+//			Timeout(5 * time.Minute).
+//			Run(c)
+type CommandBuilder struct {
+	commandstr string
+	// argv is set for commands which are not parsed
+	argv []string
+	// bash runs commandstr with bash
+	bash bool
+	// embedded runs bash scripts with the embedded shell
+	embedded bool
+
+	dir     string
+	env     []string
+	data    M
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+	capture int
+	timeout time.Duration
+	retry   *retryPolicy
+
+	// files the stdio is redirected to
+	stdinPath    string
+	stdoutPath   string
+	stderrPath   string
+	appendStdout bool
+}
+
+// Result is the outcome of a command.
+type Result struct {
+	// ExitCode is the exit code of the last command run, -1 if it did not
+	// exit normally.
+	ExitCode int
+	// Stdout is the captured STDOUT.
+	Stdout string
+	// Stderr is the captured STDERR.
+	Stderr string
+	// Output is the captured STDOUT and STDERR interleaved.
+	Output string
+	// Duration is how long the command ran.
+	Duration time.Duration
+}
+
+// Command creates a command from a command string. Each line is a command
+// split into words with SplitWords. Go templates are expanded with Data.
+func Command(commandstr string) *CommandBuilder {
+	return &CommandBuilder{commandstr: commandstr, data: M{}}
+}
+
+// CommandArgv creates a command which runs executable with args as is.
+func CommandArgv(executable string, args ...string) *CommandBuilder {
+	argv := append([]string{executable}, args...)
+	return &CommandBuilder{commandstr: quoteWords(argv), argv: argv, data: M{}}
+}
+
+// BashCommand creates a command which runs a bash script. The script runs
+// with the embedded shell if EmbeddedShell is set.
+func BashCommand(script string) *CommandBuilder {
+	return &CommandBuilder{commandstr: script, bash: true, embedded: EmbeddedShell, data: M{}}
+}
+
+// commandOptions creates a command from the options of the exec functions.
+// The reserved keys are "$in" for the working directory and "$out" for
+// capture flags, other keys are template data.
+func commandOptions(b *CommandBuilder, options []map[string]interface{}) *CommandBuilder {
+	if len(options) == 0 {
+		return b
+	}
+	m := options[0]
+	// copied so Data does not modify the caller's map
+	b.data = M{}
+	for key, value := range m {
+		if key != "$in" && key != "$out" {
+			b.data[key] = value
+		}
+	}
+	if dir, ok := m["$in"].(string); ok {
+		b.dir = dir
+	}
+	if n, ok := m["$out"].(int); ok {
+		b.capture = n
+	}
+	return b
+}
+
+// Embedded sets whether a bash script runs with the embedded shell. See
+// EmbeddedShell.
+func (b *CommandBuilder) Embedded(enabled bool) *CommandBuilder {
+	b.embedded = enabled
+	return b
+}
+
+// Dir sets the working directory.
+func (b *CommandBuilder) Dir(dir string) *CommandBuilder {
+	b.dir = dir
+	return b
+}
+
+// Env adds key=value pairs to the environment of the command.
+func (b *CommandBuilder) Env(kvs ...string) *CommandBuilder {
+	for _, kv := range kvs {
+		b.env = append(b.env, ParseStringEnv(kv)...)
+	}
+	return b
+}
+
+// Data sets a value for {{...}} templates in the command string.
+func (b *CommandBuilder) Data(key string, value interface{}) *CommandBuilder {
+	b.data[key] = value
+	return b
+}
+
+// Stdin sets the STDIN of the command. The default is os.Stdin, or no input
+// while the watch console reads the terminal.
+func (b *CommandBuilder) Stdin(r io.Reader) *CommandBuilder {
+	b.stdin = r
+	return b
+}
+
+// Stdout sets the writer for STDOUT. The default is os.Stdout.
+func (b *CommandBuilder) Stdout(w io.Writer) *CommandBuilder {
+	b.stdout = w
+	return b
+}
+
+// Stderr sets the writer for STDERR. The default is os.Stderr.
+func (b *CommandBuilder) Stderr(w io.Writer) *CommandBuilder {
+	b.stderr = w
+	return b
+}
+
+// StdinFrom reads STDIN from a file, like < path. A relative path is
+// relative to the working directory of the command.
+func (b *CommandBuilder) StdinFrom(path string) *CommandBuilder {
+	b.stdinPath = path
+	return b
+}
+
+// StdoutTo writes STDOUT to a file, like > path.
+func (b *CommandBuilder) StdoutTo(path string) *CommandBuilder {
+	b.stdoutPath = path
+	b.appendStdout = false
+	return b
+}
+
+// AppendTo appends STDOUT to a file, like >> path.
+func (b *CommandBuilder) AppendTo(path string) *CommandBuilder {
+	b.stdoutPath = path
+	b.appendStdout = true
+	return b
+}
+
+// StderrTo writes STDERR to a file, like 2> path.
+func (b *CommandBuilder) StderrTo(path string) *CommandBuilder {
+	b.stderrPath = path
+	return b
+}
+
+// Capture records STDOUT and STDERR in the Result. Output is still written
+// to Stdout and Stderr.
+func (b *CommandBuilder) Capture() *CommandBuilder {
+	b.capture = CaptureBoth
+	return b
+}
+
+// Timeout kills the command if it runs longer than d.
+func (b *CommandBuilder) Timeout(d time.Duration) *CommandBuilder {
+	b.timeout = d
+	return b
+}
+
+// Retry reruns the command up to n times if it fails, waiting backoff
+// before the first retry and doubling the wait after each retry. Retries
+// stop when the run is cancelled.
+//
+//		do.Command("curl -fsS {{.url}}").Data("url", url).
+//			Retry(3, time.Second).
+//			RetryOnExit(6, 7).
+//			Run(c)
+func (b *CommandBuilder) Retry(n int, backoff time.Duration) *CommandBuilder {
+	b.retryPolicy().setRetry(n, backoff)
+	return b
+}
+
+// RetryOnExit only retries the command if it exits with one of codes.
+func (b *CommandBuilder) RetryOnExit(codes ...int) *CommandBuilder {
+	b.retryPolicy().onExit(codes)
+	return b
+}
+
+// RetryOnOutput only retries the command if its output or error matches
+// one of the regular expressions in patterns. Output is captured to match
+// it.
+func (b *CommandBuilder) RetryOnOutput(patterns ...string) *CommandBuilder {
+	b.retryPolicy().onOutput(patterns)
+	return b
+}
+
+func (b *CommandBuilder) retryPolicy() *retryPolicy {
+	if b.retry == nil {
+		b.retry = &retryPolicy{}
+	}
+	return b.retry
+}
+
+// Run runs the command. context may be nil. When context is in error the
+// command is skipped, otherwise an error is also set on context.
+func (b *CommandBuilder) Run(context *Context) (*Result, error) {
+	if context != nil && context.Error != nil {
+		logVerbose(context.Task.Name, "Context is in error. Skipping: %s\n", Mask(b.commandstr))
+		return &Result{ExitCode: -1}, context.Error
+	}
+	result, err := b.run(context)
+	if err != nil && context != nil {
+		context.fail(err)
+	}
+	return result, err
+}
+
+// Start starts the command asynchronously. See godo.Start.
+func (b *CommandBuilder) Start(context *Context) error {
+	if context != nil && context.Error != nil {
+		logVerbose(context.Task.Name, "Context is in error. Skipping: %s\n", Mask(b.commandstr))
+		return context.Error
+	}
+	err := startEx(context, b)
+	if err != nil && context != nil {
+		context.fail(err)
+	}
+	return err
+}
+
+// expand expands templates in the command string.
+func (b *CommandBuilder) expand() (string, error) {
+	if b.argv != nil || !strings.Contains(b.commandstr, "{{") {
+		return b.commandstr, nil
+	}
+	return util.StrTemplate(b.commandstr, templateData(b.data))
+}
+
+// commands returns the commands to run.
+func (b *CommandBuilder) commands(context *Context, dir string) ([]*command, error) {
+	commandstr, err := b.expand()
+	if err != nil {
+		return nil, err
+	}
+
+	capture := b.capture
+	if b.retry.captures() || context != nil && context.Task != nil && context.Task.retry.captures() {
+		capture |= CaptureBoth
+	}
+
+	newCommand := func(executable string, argv, env []string, line int) *command {
+		return &command{
+			executable: executable,
+			argv:       argv,
+			// assignments of a command string are already expanded
+			env:        append(interpolatedVars(b.env), literalVars(env)...),
+			wd:         dir,
+			line:       line,
+			capture:    capture,
+			stdin:      b.stdin,
+			stdout:     b.stdout,
+			stderr:     b.stderr,
+			timeout:    b.timeout,
+			commandstr: commandstr,
+			context:    context,
+		}
+	}
+
+	switch {
+	case b.argv != nil:
+		return []*command{newCommand(b.argv[0], b.argv[1:], nil, 0)}, nil
+	case b.bash:
+		gcmd := newCommand("bash", []string{"-c", commandstr}, nil, 0)
+		if b.embedded {
+			gcmd.script = parseEmbedded(commandstr)
+		}
+		return []*command{gcmd}, nil
+	}
+
+	parsed, err := parseCommands(commandstr, lookupEnv(context, b.env))
+	if err != nil {
+		return nil, err
+	}
+	var cmds []*command
+	for _, sc := range parsed {
+		executable, argv, env, err := sc.split()
+		if err != nil {
+			return nil, err
+		}
+		gcmd := newCommand(executable, argv, env, sc.line)
+		gcmd.parsed = true
+		cmds = append(cmds, gcmd)
+	}
+	return cmds, nil
+}
+
+// openRedirects opens the files cmds are redirected to. The files must be
+// closed after cmds have run.
+func (b *CommandBuilder) openRedirects(dir string, cmds []*command) (files []*os.File, err error) {
+	open := func(path string, flag int) (*os.File, error) {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		f, err := os.OpenFile(path, flag, 0644)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+		return f, nil
+	}
+	defer func() {
+		if err != nil {
+			closeFiles(files)
+			files = nil
+		}
+	}()
+
+	if b.stdinPath != "" {
+		f, err := open(b.stdinPath, os.O_RDONLY)
+		if err != nil {
+			return nil, err
+		}
+		for _, gcmd := range cmds {
+			gcmd.stdin = f
+		}
+	}
+	if b.stdoutPath != "" {
+		flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if b.appendStdout {
+			flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		f, err := open(b.stdoutPath, flag)
+		if err != nil {
+			return nil, err
+		}
+		for _, gcmd := range cmds {
+			gcmd.stdout = f
+		}
+	}
+	if b.stderrPath != "" {
+		f, err := open(b.stderrPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+		if err != nil {
+			return nil, err
+		}
+		for _, gcmd := range cmds {
+			gcmd.stderr = f
+		}
+	}
+	return files, nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// run runs the command, retrying it as configured with Retry. The result of
+// a failed command is recorded on context for the retry policy of the task.
+func (b *CommandBuilder) run(context *Context) (*Result, error) {
+	var result *Result
+	name := "#"
+	var cancelled chan struct{}
+	if context != nil {
+		if context.Task != nil {
+			name = context.Task.Name
+		}
+		if context.inv != nil {
+			cancelled = context.inv.cancelled
+		}
+	}
+	err := b.retry.do(name, cancelled, func() (*Result, error) {
+		var err error
+		result, err = b.runOnce(context)
+		return result, err
+	})
+	if err != nil && context != nil {
+		context.failed = result
+	}
+	return result, err
+}
+
+func (b *CommandBuilder) runOnce(context *Context) (*Result, error) {
+	start := time.Now()
+	result := &Result{ExitCode: -1}
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
+	dir, err := resolveDir(b.dir)
+	if err != nil {
+		return result, err
+	}
+	cmds, err := b.commands(context, dir)
+	if err != nil {
+		return result, err
+	}
+	files, err := b.openRedirects(dir, cmds)
+	if err != nil {
+		return result, err
+	}
+	defer closeFiles(files)
+
+	var stdout, stderr, output []string
+	defer func() {
+		result.Stdout = strings.Join(stdout, "")
+		result.Stderr = strings.Join(stderr, "")
+		result.Output = strings.Join(output, "")
+	}()
+	for _, gcmd := range cmds {
+		s, err := gcmd.run()
+		result.ExitCode = gcmd.exitCode
+		stdout = append(stdout, Mask(gcmd.stdoutBuf.String()))
+		stderr = append(stderr, Mask(gcmd.stderrBuf.String()))
+		output = append(output, s)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,77 @@
+package godo
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestCommandBuilder(t *testing.T) {
+	if isWindows {
+		return
+	}
+	var stdout, stderr bytes.Buffer
+	result, err := BashCommand(`read line; echo -n "$line $BUILDER_A {{.name}}"; echo -n oops >&2; exit 3`).
+		Env("BUILDER_A=a").
+		Data("name", "mario").
+		Stdin(strings.NewReader("hello\n")).
+		Stdout(&stdout).
+		Stderr(&stderr).
+		Capture().
+		Run(nil)
+	assert.Error(t, err)
+	assert.Equal(t, 3, result.ExitCode)
+	assert.Equal(t, "hello a mario", result.Stdout)
+	assert.Equal(t, "oops", result.Stderr)
+	assert.Equal(t, "hello a mario", stdout.String())
+	assert.Contains(t, stderr.String(), "oops")
+	assert.True(t, result.Duration > 0)
+
+	result, err = Command("cat foo.txt").Dir("test").Stdout(&bytes.Buffer{}).Capture().Run(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.ExitCode)
+	assert.Equal(t, "foo\n", result.Output)
+
+	_, err = Command("ls").Dir("doesnotexist").Run(nil)
+	assert.Error(t, err)
+}
+
+func TestCommandBuilderTimeout(t *testing.T) {
+	if isWindows {
+		return
+	}
+	start := time.Now()
+	result, err := Command("sleep 5").Timeout(50 * time.Millisecond).Run(nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+	assert.Equal(t, -1, result.ExitCode)
+	assert.True(t, time.Since(start) < 2*time.Second)
+}
+
+func TestCommandBuilderContext(t *testing.T) {
+	if isWindows {
+		return
+	}
+	ran := false
+	tasks := func(p *Project) {
+		p.Task("foo", nil, func(c *Context) {
+			CommandArgv("bash", "-c", "exit 1").Run(c)
+			_, err := CommandArgv("bash", "-c", "exit 0").Run(c)
+			ran = err == nil
+		})
+	}
+	_, err := runTask(tasks, "foo")
+	assert.Error(t, err)
+	assert.False(t, ran)
+}
+
+func TestCommandOptions(t *testing.T) {
+	options := M{"$in": "test", "$out": CaptureStdout, "name": "mario"}
+	b := commandOptions(Command("echo {{.name}}"), []map[string]interface{}{options}).Data("age", 30)
+	assert.Equal(t, "test", b.dir)
+	assert.Equal(t, M{"name": "mario", "age": 30}, b.data)
+	assert.Equal(t, M{"$in": "test", "$out": CaptureStdout, "name": "mario"}, options)
+}
@@ -3,9 +3,12 @@ package godo
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/mgutz/ansi"
 	"gopkg.in/godo.v2/util"
@@ -31,61 +34,232 @@ type command struct {
 	// parsed argv
 	argv []string
 	// parsed env
-	env []string
+	env []envVar
 	// working directory
 	wd string
+	// line of the command string on which the command starts
+	line int
+	// parsed is set for commands parsed from a command string
+	parsed bool
 	// bitmask to capture output
 	capture int
 	// the output buf
+	buf syncBuffer
+	// the captured STDOUT and STDERR
+	stdoutBuf bytes.Buffer
+	stderrBuf bytes.Buffer
+	// stderrTail is the tail of STDERR for an ExecError, kept even if
+	// STDERR is not captured
+	stderrTail tailBuffer
+	// stdio, defaults to os.Stdin, os.Stdout and os.Stderr. stdin defaults
+	// to the null device while the watch console reads the terminal.
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	// timeout kills the command if non-zero
+	timeout time.Duration
+	// exitCode is set after the command exits, -1 if it did not exit normally
+	exitCode int
+	// signal is the signal which killed the command
+	signal string
+	// started is when the command started
+	started time.Time
+	// script is run with the embedded shell instead of executable if set
+	script ShellScript
+	// context of the task running this command, may be nil
+	context *Context
+	// streams echo captured output
+	streams []*fileWrapper
+}
+
+// syncBuffer is a buffer for output which is written from both STDOUT and
+// STDERR.
+type syncBuffer struct {
+	sync.Mutex
 	buf bytes.Buffer
 }
 
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.Lock()
+	defer sb.Unlock()
+	return sb.buf.Write(p)
+}
+
+func (sb *syncBuffer) String() string {
+	sb.Lock()
+	defer sb.Unlock()
+	return sb.buf.String()
+}
+
 func (gcmd *command) toExecCmd() (cmd *exec.Cmd, err error) {
 	cmd = exec.Command(gcmd.executable, gcmd.argv...)
 	if gcmd.wd != "" {
 		cmd.Dir = gcmd.wd
 	}
+	cmd.Env = gcmd.environ()
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = gcmd.stdio()
+	gcmd.debug()
+	gcmd.started = time.Now()
+	return cmd, nil
+}
+
+// environ returns the effective environment of the command.
+func (gcmd *command) environ() []string {
+	env := gcmd.env
+	if gcmd.context != nil {
+		env = append(gcmd.context.environ(), env...)
+	}
+	return overlayEnv(env)
+}
 
-	cmd.Env = EffectiveEnv(gcmd.env)
-	cmd.Stdin = os.Stdin
+// stdio returns the stdio of the command, wrapping STDOUT and STDERR to
+// capture output.
+func (gcmd *command) stdio() (stdin io.Reader, stdout, stderr io.Writer) {
+	stdin, stdout, stderr = gcmd.stdin, gcmd.stdout, gcmd.stderr
+	if stdin == nil && !consoleOwnsStdin() {
+		stdin = os.Stdin
+	}
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	if stderr == nil {
+		stderr = os.Stderr
+	}
 
 	if gcmd.capture&CaptureStderr > 0 {
-		cmd.Stderr = newFileWrapper(os.Stderr, &gcmd.buf, ansi.Red)
-	} else {
-		cmd.Stderr = os.Stderr
+		stream := newFileWrapper(stderr, io.MultiWriter(&gcmd.buf, &gcmd.stderrBuf), ansi.Red)
+		gcmd.streams = append(gcmd.streams, stream)
+		stderr = stream
 	}
 	if gcmd.capture&CaptureStdout > 0 {
-		cmd.Stdout = newFileWrapper(os.Stdout, &gcmd.buf, "")
-	} else {
-		cmd.Stdout = os.Stdout
+		stream := newFileWrapper(stdout, io.MultiWriter(&gcmd.buf, &gcmd.stdoutBuf), "")
+		gcmd.streams = append(gcmd.streams, stream)
+		stdout = stream
 	}
+	stderr = io.MultiWriter(stderr, &gcmd.stderrTail)
+	return
+}
 
-	if verbose {
-		if Env != "" {
-			util.Debug("#", "Env: %s\n", Env)
-		}
-		if gcmd.wd != "" {
-			util.Debug("#", "Dir: %s\n", gcmd.wd)
-		}
-		util.Debug("#", "%s\n", gcmd.commandstr)
+func (gcmd *command) debug() {
+	if !verbose {
+		return
+	}
+	if env := gcmd.environ(); len(env) > 0 {
+		util.Debug("#", "Env: %s\n", Mask(strings.Join(env, " ")))
 	}
+	if gcmd.wd != "" {
+		util.Debug("#", "Dir: %s\n", gcmd.wd)
+	}
+	util.Debug("#", "%s\n", Mask(gcmd.commandstr))
+}
 
-	return cmd, nil
+// finish records the exit code and returns the captured output once the
+// command has exited. err is returned as an *ExecError.
+func (gcmd *command) finish(exitCode int, err error) (string, error) {
+	gcmd.exitCode = exitCode
+	if gcmd.context != nil && gcmd.context.inv != nil {
+		gcmd.context.inv.tracer.command(gcmd)
+	}
+	for _, stream := range gcmd.streams {
+		stream.flush()
+	}
+	if err != nil {
+		err = gcmd.execError(err)
+	}
+	if gcmd.capture > 0 {
+		return Mask(gcmd.buf.String()), err
+	}
+	return "", err
+}
+
+// execError returns err with the details of the command.
+func (gcmd *command) execError(err error) *ExecError {
+	if execErr, ok := err.(*ExecError); ok {
+		return execErr
+	}
+	var duration time.Duration
+	if !gcmd.started.IsZero() {
+		duration = time.Since(gcmd.started)
+	}
+	argv := []string{Mask(gcmd.executable)}
+	for _, arg := range gcmd.argv {
+		argv = append(argv, Mask(arg))
+	}
+	return &ExecError{
+		Command:  Mask(gcmd.commandstr),
+		Argv:     argv,
+		Dir:      gcmd.wd,
+		Line:     gcmd.line,
+		ExitCode: gcmd.exitCode,
+		Signal:   gcmd.signal,
+		Duration: duration,
+		Stderr:   tailLines(Mask(gcmd.stderrTail.String()), stderrTailLines),
+		Err:      err,
+		showLine: gcmd.parsed,
+	}
 }
 
 func (gcmd *command) run() (string, error) {
-	var err error
+	if gcmd.script != nil {
+		return gcmd.interpret()
+	}
 	cmd, err := gcmd.toExecCmd()
+	if err == nil {
+		err = cmd.Start()
+	}
 	if err != nil {
-		return "", err
+		return gcmd.finish(-1, err)
 	}
+	return gcmd.wait(cmd)
+}
 
-	err = cmd.Run()
-	if gcmd.capture > 0 {
-		return gcmd.buf.String(), err
+// wait waits for the started cmd to exit and returns the captured output.
+func (gcmd *command) wait(cmd *exec.Cmd) (string, error) {
+	err := gcmd.watch(cmd)
+	exitCode := -1
+	if cmd.ProcessState != nil {
+		exitCode = cmd.ProcessState.ExitCode()
+		gcmd.signal = exitSignal(cmd.ProcessState)
 	}
-	return "", err
+	return gcmd.finish(exitCode, err)
+}
 
+// watch waits for cmd, killing it if the run it belongs to is cancelled or
+// it times out.
+func (gcmd *command) watch(cmd *exec.Cmd) error {
+	var cancelled chan struct{}
+	if gcmd.context != nil && gcmd.context.inv != nil {
+		cancelled = gcmd.context.inv.cancelled
+	}
+	if cancelled == nil && gcmd.timeout == 0 {
+		return cmd.Wait()
+	}
+
+	var timeout <-chan time.Time
+	if gcmd.timeout > 0 {
+		timer := time.NewTimer(gcmd.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	killed := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-cancelled:
+			cmd.Process.Kill()
+		case <-timeout:
+			killed <- fmt.Errorf("%w after %s", ErrTimeout, gcmd.timeout)
+			cmd.Process.Kill()
+		case <-done:
+		}
+	}()
+	err := cmd.Wait()
+	select {
+	case err = <-killed:
+	default:
+	}
+	return err
 }
 
 func (gcmd *command) runAsync() error {
@@ -108,7 +282,7 @@ func (gcmd *command) runAsync() error {
 		}
 		Processes[id] = cmd.Process
 		if verbose {
-			util.Debug("#", "Processes[%q] added\n", id)
+			util.Debug("#", "Processes[%q] added\n", Mask(id))
 		}
 		cmd.Wait()
 		runnerWaitGroup.Done()
@@ -130,6 +304,6 @@ func killSpawned(command string) {
 		return
 	}
 	if verbose {
-		util.Debug("#", "Processes[%q] killed\n", command)
+		util.Debug("#", "Processes[%q] killed\n", Mask(command))
 	}
 }
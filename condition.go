@@ -0,0 +1,94 @@
+package godo
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Condition decides whether a task runs. See Task#When and Task#Unless.
+type Condition struct {
+	// Desc describes the condition when it holds, e.g. "$CI is set".
+	Desc string
+	// Test determines if the condition holds.
+	Test func() bool
+	// notDesc describes the condition when it does not hold
+	notDesc string
+}
+
+// Predicate creates a condition from a func. desc describes the condition
+// when it holds.
+//
+//		p.Task("sign", nil, sign).When(do.Predicate("on macOS", func() bool {
+//			return runtime.GOOS == "darwin"
+//		}))
+func Predicate(desc string, test func() bool) Condition {
+	return Condition{Desc: desc, Test: test}
+}
+
+// EnvSet holds if the environment variable name is set and not empty.
+func EnvSet(name string) Condition {
+	return Condition{
+		Desc:    "$" + name + " is set",
+		notDesc: "$" + name + " is not set",
+		Test: func() bool {
+			return Getenv(name) != ""
+		},
+	}
+}
+
+// FileExists holds if the file or directory path exists.
+func FileExists(path string) Condition {
+	return Condition{
+		Desc:    path + " exists",
+		notDesc: path + " does not exist",
+		Test: func() bool {
+			_, err := os.Stat(path)
+			return err == nil
+		},
+	}
+}
+
+// CommandSucceeds holds if commandstr runs and exits with 0. Its output is
+// discarded.
+func CommandSucceeds(commandstr string) Condition {
+	commandstr = strings.TrimSpace(commandstr)
+	return Condition{
+		Desc:    "`" + commandstr + "` succeeds",
+		notDesc: "`" + commandstr + "` fails",
+		Test: func() bool {
+			_, err := Command(commandstr).
+				Stdin(strings.NewReader("")).
+				Stdout(ioutil.Discard).
+				Stderr(ioutil.Discard).
+				run(nil)
+			return err == nil
+		},
+	}
+}
+
+func (c Condition) describe(holds bool) string {
+	if holds {
+		return c.Desc
+	}
+	if c.notDesc != "" {
+		return c.notDesc
+	}
+	return "not " + c.Desc
+}
+
+// skipReason evaluates the conditions of task and returns why it is skipped,
+// or "" if it runs.
+func (task *Task) skipReason() string {
+	for _, c := range task.when {
+		if holds := c.Test(); !holds {
+			return c.describe(holds)
+		}
+	}
+	for _, c := range task.unless {
+		if holds := c.Test(); holds {
+			return c.describe(holds)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,108 @@
+package godo
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"gopkg.in/godo.v2/util"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+// captureLog returns the log written by fn.
+func captureLog(fn func()) string {
+	var buf bytes.Buffer
+	old := util.LogWriter
+	util.LogWriter = &buf
+	defer func() {
+		util.LogWriter = old
+	}()
+	fn()
+	return buf.String()
+}
+
+func TestWhenUnless(t *testing.T) {
+	os.Setenv("GODO_COND_SET", "1")
+	defer os.Unsetenv("GODO_COND_SET")
+	SetEnviron("", true)
+
+	ran := []string{}
+	tasks := func(p *Project) {
+		p.Task1("dep", func(*Context) { ran = append(ran, "dep") })
+		p.Task("env", S{"dep"}, func(*Context) { ran = append(ran, "env") }).
+			When(EnvSet("GODO_COND_UNSET"))
+		p.Task1("file", func(*Context) { ran = append(ran, "file") }).
+			Unless(FileExists("test/foo.txt"))
+		p.Task1("custom", func(*Context) { ran = append(ran, "custom") }).
+			When(EnvSet("GODO_COND_SET"), Predicate("on fire", func() bool { return true }))
+		p.Task("default", S{"env", "file", "custom"}, nil)
+	}
+
+	var err error
+	log := captureLog(func() {
+		_, err = runTask(tasks, "default")
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"custom"}, ran)
+	assert.Contains(t, log, "skipped ($GODO_COND_UNSET is not set)")
+	assert.Contains(t, log, "skipped (test/foo.txt exists)")
+}
+
+func TestConditionOncePerRun(t *testing.T) {
+	tests := 0
+	ran := 0
+	tasks := func(p *Project) {
+		p.Task1("sign", func(*Context) { ran++ }).
+			When(Predicate("signing key", func() bool {
+				tests++
+				return tests > 1
+			}))
+		p.Task("a", S{"sign"}, nil)
+		p.Task("b", S{"sign"}, nil)
+		p.Task("default", S{"a", "b"}, nil)
+	}
+	proj, err := runTask(tasks, "default")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, tests)
+	assert.Equal(t, 0, ran)
+
+	// the skipped run did not debounce this one
+	assert.NoError(t, proj.Run("sign"))
+	assert.Equal(t, 2, tests)
+	assert.Equal(t, 1, ran)
+}
+
+func TestCommandSucceeds(t *testing.T) {
+	if isWindows {
+		return
+	}
+	assert.True(t, CommandSucceeds("true").Test())
+	assert.False(t, CommandSucceeds("false").Test())
+	assert.False(t, CommandSucceeds("godo-does-not-exist").Test())
+	assert.Equal(t, "`false` fails", CommandSucceeds("false").describe(false))
+	assert.Equal(t, "not on fire", Predicate("on fire", nil).describe(false))
+}
+
+func TestDryRun(t *testing.T) {
+	dryRun = true
+	defer func() {
+		dryRun = false
+	}()
+
+	ran := false
+	tasks := func(p *Project) {
+		p.Task1("build", func(*Context) { ran = true })
+		p.Task1("sign", func(*Context) { ran = true }).
+			When(Predicate("signing key", func() bool { return false }))
+		p.Task("default", S{"build", "sign"}, nil)
+	}
+	var err error
+	log := captureLog(func() {
+		_, err = runTask(tasks, "default")
+	})
+	assert.NoError(t, err)
+	assert.False(t, ran)
+	assert.Contains(t, log, "default>build")
+	assert.Contains(t, log, "would run")
+	assert.Contains(t, log, "skipped (not signing key)")
+}
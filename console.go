@@ -0,0 +1,249 @@
+package godo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"gopkg.in/godo.v2/util"
+)
+
+const consoleHelp = `Watch commands:
+  r  rerun all watched tasks
+  t  pick a task to run
+  c  clear the screen
+  p  pause or resume watching
+  l  show the last failure and its STDERR
+  q  quit
+  h  this screen
+`
+
+// console reads single-key commands from the terminal while watching.
+type console struct {
+	project *Project
+	// names are the watched task names
+	names []string
+	in    *bufio.Reader
+	out   io.Writer
+	// exit exits godo, the project's Exit
+	exit func(code int)
+
+	restore func()
+	// stopSignals stops catching Ctrl+C
+	stopSignals func()
+	closeOnce   sync.Once
+}
+
+// consoleReading is non-zero while a console reads the terminal. Commands
+// then do not inherit stdin, so keys reach the console and commands do not
+// read a terminal without echo.
+var consoleReading int32
+
+// consoleOwnsStdin determines if a console reads the terminal.
+func consoleOwnsStdin() bool {
+	return atomic.LoadInt32(&consoleReading) != 0
+}
+
+// isTerminal determines if f is a character device such as a TTY. The null
+// device is a character device too, so it is excluded.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(fi, null)
+}
+
+// startConsole starts the watch console on stdin. Returns nil if stdin is not
+// a terminal.
+func (project *Project) startConsole(names []string) *console {
+	if !isTerminal(os.Stdin) {
+		logVerbose("godo", "stdin is not a terminal, console disabled\n")
+		return nil
+	}
+
+	con := &console{
+		project: project,
+		names:   names,
+		in:      bufio.NewReader(os.Stdin),
+		out:     os.Stdout,
+		exit:    project.Exit,
+	}
+
+	restore, err := setCbreak()
+	if err != nil {
+		if runtime.GOOS != "windows" {
+			// stty fails when stdin is not a terminal
+			logVerbose("godo", "console disabled: %s\n", err.Error())
+			return nil
+		}
+		util.Info("godo", "press a command key followed by Enter, h for help\n")
+		restore = func() {}
+	} else {
+		util.Info("godo", "press h for watch commands\n")
+	}
+	con.restore = restore
+	atomic.StoreInt32(&consoleReading, 1)
+
+	// Ctrl+C must not leave the terminal without echo
+	csig := make(chan os.Signal, 1)
+	stopped := make(chan struct{})
+	signal.Notify(csig, os.Interrupt)
+	con.stopSignals = func() {
+		signal.Stop(csig)
+		close(stopped)
+	}
+	go func() {
+		select {
+		case <-csig:
+			con.close()
+			// the exit code of a shell for SIGINT
+			con.exit(130)
+		case <-stopped:
+		}
+	}()
+
+	go con.loop()
+	return con
+}
+
+// close stops catching Ctrl+C and restores the terminal.
+func (con *console) close() {
+	con.closeOnce.Do(func() {
+		if con.stopSignals != nil {
+			con.stopSignals()
+		}
+		con.restore()
+		atomic.StoreInt32(&consoleReading, 0)
+	})
+}
+
+func (con *console) loop() {
+	for {
+		b, err := con.in.ReadByte()
+		if err != nil {
+			return
+		}
+		if !con.handle(b) {
+			return
+		}
+	}
+}
+
+// handle executes the command for key. Returns false when the console
+// should stop reading.
+func (con *console) handle(key byte) bool {
+	project := con.project
+	switch key {
+	case 'r':
+		con.run(con.names...)
+	case 't':
+		con.pickTask()
+	case 'c':
+		fmt.Fprint(con.out, "\033[H\033[2J")
+	case 'p':
+		if project.togglePause() {
+			util.Info("godo", "watching paused, press p to resume\n")
+		} else {
+			util.Info("godo", "watching resumed\n")
+		}
+	case 'l':
+		failure := project.lastFailure()
+		if failure == "" {
+			util.Info("godo", "no failures\n")
+		} else {
+			fmt.Fprintln(con.out, failure)
+		}
+	case 'q':
+		con.close()
+		con.exit(0)
+		return false
+	case 'h', '?':
+		fmt.Fprint(con.out, consoleHelp)
+	}
+	return true
+}
+
+// pickTask lists all tasks and runs the one selected by number.
+func (con *console) pickTask() {
+	names, _ := con.project.allTasks()
+	for i, name := range names {
+		fmt.Fprintf(con.out, "  %2d  %s\n", i+1, name)
+	}
+	fmt.Fprint(con.out, "task number: ")
+	line := con.readLine()
+	n, err := strconv.Atoi(line)
+	if err != nil || n < 1 || n > len(names) {
+		if line != "" {
+			util.Error("godo", "invalid task number %q\n", line)
+		}
+		return
+	}
+	con.run(names[n-1])
+}
+
+// readLine reads a line echoing each character since the terminal
+// does not echo in cbreak mode.
+func (con *console) readLine() string {
+	var line []byte
+	for {
+		b, err := con.in.ReadByte()
+		if err != nil || b == '\n' || b == '\r' {
+			fmt.Fprintln(con.out)
+			return strings.TrimSpace(string(line))
+		}
+		if b == 127 || b == '\b' {
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				fmt.Fprint(con.out, "\b \b")
+			}
+			continue
+		}
+		line = append(line, b)
+		fmt.Fprintf(con.out, "%c", b)
+	}
+}
+
+// run reruns tasks in the background from scratch. Each cancels the
+// in-flight run of its graph like a watch event does.
+func (con *console) run(names ...string) {
+	for _, name := range names {
+		inv := newInvocation(nil)
+		inv.forced = true
+		con.project.watchRunner(name).start(inv)
+	}
+}
+
+// setCbreak switches the terminal to unbuffered input without echo and
+// returns a func which restores the previous state.
+func setCbreak() (func(), error) {
+	if runtime.GOOS == "windows" {
+		return nil, fmt.Errorf("cbreak mode not supported on windows")
+	}
+	state, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = stty("cbreak", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() {
+		stty(strings.TrimSpace(state))
+	}, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
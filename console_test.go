@@ -0,0 +1,97 @@
+package godo
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestConsoleCommands(t *testing.T) {
+	ran := make(chan string, 1)
+	tasks := func(p *Project) {
+		p.Task("A", nil, func(*Context) {})
+		p.Task("B", nil, func(*Context) {
+			ran <- "B"
+		})
+	}
+	proj := NewProject(tasks, nil, nil)
+
+	var out bytes.Buffer
+	restored := false
+	exitCode := -1
+	con := &console{
+		project: proj,
+		names:   []string{"A"},
+		in:      bufio.NewReader(strings.NewReader("2\n")),
+		out:     &out,
+		exit:    func(code int) { exitCode = code },
+		restore: func() { restored = true },
+	}
+
+	assert.True(t, con.handle('p'))
+	assert.True(t, proj.isPaused())
+	assert.True(t, con.handle('p'))
+	assert.False(t, proj.isPaused())
+
+	proj.recordFailure(&ExecError{Err: errors.New("boom"), Stderr: "permission denied"})
+	con.handle('l')
+	assert.Contains(t, out.String(), "boom\npermission denied")
+
+	con.handle('t')
+	select {
+	case name := <-ran:
+		assert.Equal(t, "B", name)
+	case <-time.After(time.Second):
+		t.Error("picked task did not run")
+	}
+
+	assert.False(t, con.handle('q'))
+	assert.True(t, restored)
+	assert.Equal(t, 0, exitCode)
+}
+
+func TestConsoleStdin(t *testing.T) {
+	con := &console{restore: func() {}}
+	atomic.StoreInt32(&consoleReading, 1)
+	defer con.close()
+
+	// commands do not read the keys of the console
+	stdin, _, _ := (&command{}).stdio()
+	assert.Nil(t, stdin)
+	stdin, _, _ = (&command{stdin: strings.NewReader("x")}).stdio()
+	assert.NotNil(t, stdin)
+
+	con.close()
+	stdin, _, _ = (&command{}).stdio()
+	assert.Equal(t, os.Stdin, stdin)
+}
+
+func TestConsoleRerun(t *testing.T) {
+	ran := make(chan string, 2)
+	tasks := func(p *Project) {
+		p.Task("A?", nil, func(*Context) {
+			ran <- "A"
+		})
+	}
+	proj := NewProject(tasks, nil, nil)
+	con := &console{project: proj, names: []string{"A"}, out: &bytes.Buffer{}, restore: func() {}}
+
+	// RunOnce tasks which already ran are rerun too
+	proj.Tasks["A"].Complete = true
+	for i := 0; i < 2; i++ {
+		con.handle('r')
+		select {
+		case name := <-ran:
+			assert.Equal(t, "A", name)
+		case <-time.After(time.Second):
+			t.Fatal("task did not rerun")
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package godo
 
 import (
+	"errors"
+
 	"github.com/mgutz/minimist"
 	"gopkg.in/godo.v2/util"
 	"gopkg.in/godo.v2/watcher"
@@ -25,6 +27,52 @@ type Context struct {
 	Args minimist.ArgMap
 
 	Error error
+
+	// inv is the run this context belongs to
+	inv *invocation
+	// env are the variables set with Setenv
+	env []string
+	// failed is the result of the command which failed, for retries
+	failed *Result
+	// logName is the name the task is logged as in this run
+	logName string
+}
+
+// fail adds err to the errors of the context. Unlike setting Error, an
+// earlier error is kept.
+func (context *Context) fail(err error) {
+	switch {
+	case context.Error == nil:
+		context.Error = err
+	case !errors.Is(err, context.Error):
+		if list, ok := context.Error.(errorList); ok {
+			context.Error = append(list, err)
+		} else {
+			context.Error = errorList{context.Error, err}
+		}
+	}
+}
+
+// Setenv sets an environment variable for the commands run by this context.
+// Other tasks, including those running in parallel, are not affected. value
+// is used as is, $VAR is not expanded.
+func (context *Context) Setenv(key, value string) {
+	context.env = append(context.env, key+"="+value)
+}
+
+// Getenv gets an environment variable as seen by the commands run by this
+// context.
+func (context *Context) Getenv(key string) string {
+	return getEnv(overlayEnv(context.environ()), key, false)
+}
+
+// environ returns the task and context overlays of the base environment.
+func (context *Context) environ() []envVar {
+	var env []envVar
+	if context.Task != nil {
+		env = interpolatedVars(context.Task.env)
+	}
+	return append(env, literalVars(context.env)...)
 }
 
 // AnyFile returns either a non-DELETe FileEvent file or the WatchGlob patterns which
@@ -36,40 +84,58 @@ func (context *Context) AnyFile() []string {
 	return context.Task.SrcGlobs
 }
 
+// Profile returns the profile selected with --profile. The name of the
+// profile is empty when none was selected.
+func (context *Context) Profile() *Profile {
+	return currentProfile()
+}
+
 // Run runs a command
 func (context *Context) Run(cmd string, options ...map[string]interface{}) {
 	if context.Error != nil {
-		logVerbose(context.Task.Name, "Context is in error. Skipping: %s\n", cmd)
+		logVerbose(context.Task.Name, "Context is in error. Skipping: %s\n", Mask(cmd))
 		return
 	}
-	_, err := Run(cmd, options...)
+	_, err := run(context, cmd, options)
 	if err != nil {
-		context.Error = err
+		context.fail(err)
+	}
+}
+
+// Cmd runs executable with args as is. See godo.Cmd.
+func (context *Context) Cmd(executable string, args ...string) {
+	if context.Error != nil {
+		logVerbose(context.Task.Name, "Context is in error. Skipping: %s\n", Mask(executable))
+		return
+	}
+	err := cmdEx(context, executable, args)
+	if err != nil {
+		context.fail(err)
 	}
 }
 
 // Bash runs a bash shell.
 func (context *Context) Bash(cmd string, options ...map[string]interface{}) {
 	if context.Error != nil {
-		logVerbose(context.Task.Name, "Context is in error. Skipping: %s\n", cmd)
+		logVerbose(context.Task.Name, "Context is in error. Skipping: %s\n", Mask(cmd))
 		return
 	}
-	_, err := Bash(cmd, options...)
+	_, err := bash(context, cmd, options)
 	if err != nil {
-		context.Error = err
+		context.fail(err)
 	}
 }
 
 // Start run aysnchronously.
 func (context *Context) Start(cmd string, options ...map[string]interface{}) {
 	if context.Error != nil {
-		logVerbose(context.Task.Name, "Context is in error. Skipping: %s\n", cmd)
+		logVerbose(context.Task.Name, "Context is in error. Skipping: %s\n", Mask(cmd))
 		return
 	}
 
-	err := startEx(context, cmd, options)
+	err := startEx(context, commandOptions(Command(cmd), options))
 	if err != nil {
-		context.Error = err
+		context.fail(err)
 	}
 }
 
@@ -80,9 +146,9 @@ func (context *Context) BashOutput(script string, options ...map[string]interfac
 	} else {
 		options[0]["$out"] = CaptureBoth
 	}
-	s, err := Bash(script, options...)
+	s, err := bash(context, script, options)
 	if err != nil {
-		context.Error = err
+		context.fail(err)
 		return ""
 	}
 	return s
@@ -95,9 +161,9 @@ func (context *Context) RunOutput(commandstr string, options ...map[string]inter
 	} else {
 		options[0]["$out"] = CaptureBoth
 	}
-	s, err := Run(commandstr, options...)
+	s, err := run(context, commandstr, options)
 	if err != nil {
-		context.Error = err
+		context.fail(err)
 		return ""
 	}
 	return s
@@ -0,0 +1,80 @@
+package godo
+
+import (
+	"sort"
+	"sync"
+	"testing"
+
+	"gopkg.in/godo.v2/watcher"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestDepsFunc(t *testing.T) {
+	var mu sync.Mutex
+	ran := []string{}
+	record := func(name string) func(*Context) {
+		return func(*Context) {
+			mu.Lock()
+			ran = append(ran, name)
+			mu.Unlock()
+		}
+	}
+
+	resolved := 0
+	pkgs := []string{"util", "glob"}
+	tasks := func(p *Project) {
+		// tasks registered from data at definition time
+		for _, pkg := range pkgs {
+			p.Task1("vet-"+pkg, record("vet-"+pkg))
+		}
+
+		p.Task1("test", record("test")).DepsFunc(func() Dependency {
+			resolved++
+			// tasks registered while running
+			deps := P{}
+			for _, pkg := range pkgs {
+				name := "test-" + pkg
+				p.Task1(name, record(name))
+				deps = append(deps, name)
+			}
+			return deps
+		})
+		p.TaskD("lint", LazyDeps(func() Dependency {
+			return S{"vet-util", "vet-glob"}
+		}))
+		p.Task("default", P{"test", "lint"}, nil)
+	}
+
+	proj, err := runTask(tasks, "default")
+	assert.NoError(t, err)
+	sort.Strings(ran)
+	assert.Equal(t, []string{"test", "test-glob", "test-util", "vet-glob", "vet-util"}, ran)
+	assert.Equal(t, 1, resolved)
+
+	// LazyDeps are only resolved by running
+	assert.Empty(t, proj.Tasks["test"].DependencyNames())
+	assert.Empty(t, proj.Tasks["lint"].DependencyNames())
+	proj.usage()
+	assert.Equal(t, 1, resolved)
+}
+
+func TestDepsFuncWatch(t *testing.T) {
+	ran := []string{}
+	resolved := 0
+	tasks := func(p *Project) {
+		p.Task1("lint", func(*Context) { ran = append(ran, "lint") }).Src("test/*.txt")
+		p.TaskD("test", P{"lint"}).DepsFunc(func() Dependency {
+			resolved++
+			p.Task1("test-util", func(*Context) { ran = append(ran, "test-util") })
+			p.Task1("test-glob", func(*Context) { ran = append(ran, "test-glob") }).Src("glob/*.go")
+			return S{"test-util", "test-glob"}
+		})
+	}
+	proj := NewProject(tasks, func(int) {}, nil)
+
+	inv := proj.newWatchInvocation("test", &watcher.FileEvent{Event: watcher.MODIFIED, Path: "util/fs.go"})
+	assert.Equal(t, 0, resolved)
+	assert.NoError(t, proj.runRoot("test", inv))
+	assert.Equal(t, 1, resolved)
+	assert.Equal(t, []string{"test-util"}, ran)
+}
@@ -0,0 +1,110 @@
+package godo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dotenv are the variables loaded from dotenv files, in order. Single quoted
+// values are literal.
+var dotenv []envVar
+
+// DotenvFiles returns the dotenv files loaded for profile in the order they
+// are applied: ".env", ".env.<profile>" then ".env.local".
+func DotenvFiles(profile string) []string {
+	files := []string{".env"}
+	if profile != "" {
+		files = append(files, ".env."+profile)
+	}
+	return append(files, ".env.local")
+}
+
+// LoadDotenv loads the dotenv files for profile from the working directory.
+// Missing files are skipped. The variables are layered over the parent
+// environment and Env, and may reference variables from earlier layers with
+// $VAR or ${VAR} unless they are single quoted. The process environment is
+// not changed.
+func LoadDotenv(profile string) error {
+	var env []envVar
+	for _, name := range DotenvFiles(profile) {
+		f, err := os.Open(filepath.Join(wd, name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		vars, err := parseDotenv(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err.Error())
+		}
+		logVerbose("godo", "loaded %s\n", name)
+		env = append(env, vars...)
+	}
+
+	envMu.Lock()
+	dotenv = env
+	// rebuild lazily in EffectiveEnv
+	environ = nil
+	envMu.Unlock()
+	return nil
+}
+
+// ParseDotenv parses KEY=VALUE lines. Blank lines, lines starting with "#"
+// and an "export " prefix are ignored. Values may be single or double
+// quoted. Double quoted values expand \n and \t.
+func ParseDotenv(r io.Reader) ([]string, error) {
+	vars, err := parseDotenv(r)
+	if err != nil {
+		return nil, err
+	}
+	env := make([]string, len(vars))
+	for i, v := range vars {
+		env[i] = v.kv
+	}
+	return env, nil
+}
+
+// parseDotenv parses KEY=VALUE lines like ParseDotenv, marking single quoted
+// values as literal.
+func parseDotenv(r io.Reader) ([]envVar, error) {
+	var env []envVar
+	scanner := bufio.NewScanner(r)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		pair := splitKV(line)
+		if pair == nil {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineno)
+		}
+		key := strings.TrimSpace(pair[0])
+		value := strings.TrimSpace(pair[1])
+		literal := false
+
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			value = value[1 : len(value)-1]
+			value = strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`).Replace(value)
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+			literal = true
+		default:
+			// strip inline comments
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+		env = append(env, envVar{kv: key + "=" + value, literal: literal})
+	}
+	return env, scanner.Err()
+}
@@ -0,0 +1,66 @@
+package godo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestParseDotenv(t *testing.T) {
+	env, err := ParseDotenv(strings.NewReader(`
+# comment
+export A=1
+B = two words # inline comment
+C="line\nbreak"
+D='quoted # not a comment'
+E=
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"A=1", "B=two words", "C=line\nbreak", "D=quoted # not a comment", "E="}, env)
+
+	_, err = ParseDotenv(strings.NewReader("NOEQUALS"))
+	assert.Error(t, err)
+}
+
+func TestLoadDotenvLayers(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "godo-dotenv")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, ".env"), []byte("DOTENV_A=base\nDOTENV_B=base"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, ".env.prod"), []byte("DOTENV_B=prod-$DOTENV_A"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, ".env.local"), []byte("DOTENV_C=local\nDOTENV_PASS='a$b'"), 0644)
+
+	oldwd := wd
+	wd = dir
+	defer func() {
+		wd = oldwd
+		LoadDotenv("")
+		SetEnviron("", true)
+	}()
+
+	assert.NoError(t, LoadDotenv("prod"))
+	env := EffectiveEnv(nil)
+	assert.True(t, sliceContains(env, "DOTENV_A=base"))
+	assert.True(t, sliceContains(env, "DOTENV_B=prod-base"))
+	assert.True(t, sliceContains(env, "DOTENV_C=local"))
+	assert.True(t, sliceContains(env, "DOTENV_PASS=a$b"), "single quoted values are not interpolated")
+	assert.Equal(t, "", os.Getenv("DOTENV_A"))
+}
+
+func TestTaskEnv(t *testing.T) {
+	if isWindows {
+		return
+	}
+	output := ""
+	tasks := func(p *Project) {
+		p.Task("foo", nil, func(c *Context) {
+			output = c.BashOutput("echo -n $TASK_ENV_A $TASK_ENV_B")
+		}).Env("TASK_ENV_A=a TASK_ENV_B=$TASK_ENV_A-b")
+	}
+	runTask(tasks, "foo")
+	assert.Equal(t, "a a-b", output)
+	assert.Equal(t, "", os.Getenv("TASK_ENV_A"))
+}
@@ -4,13 +4,15 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/mgutz/str"
 )
 
 // Env is the default environment to use for all commands. That is,
 // the effective environment for all commands is the merged set
-// of (parent environment, Env, func specified environment). Whitespace
+// of (parent environment, Env, dotenv files, profile environment, task
+// environment, func specified environment). Whitespace
 // or newline separate key value pairs. $VAR interpolation is allowed.
 //
 // Env = "GOOS=linux GOARCH=amd64"
@@ -19,7 +21,53 @@ import (
 //   GOPATH=./vendor:$GOPATH
 // `
 var Env string
+
+// environ is the base environment of all commands. It is never modified in
+// place, SetEnviron replaces it with a new slice, so copies may be read
+// without locking. Tasks overlay it per run with Task#Env and Context#Setenv.
 var environ []string
+var envMu sync.RWMutex
+
+// cliEnv are the key=value pairs from the command line
+var cliEnv []string
+
+// environArgs are the arguments of the last SetEnviron call. The base
+// environment is rebuilt from them when dotenv files, the profile or command
+// line variables change. Env and InheritParentEnv are used until SetEnviron
+// is called.
+var environArgs *environSource
+
+// environSource are the arguments the base environment is built from.
+type environSource struct {
+	envstr        string
+	inheritParent bool
+}
+
+// envVar is a key=value pair overlaid on an environment.
+type envVar struct {
+	kv string
+	// literal is set for values which are used as is instead of being
+	// interpolated
+	literal bool
+}
+
+// interpolatedVars returns kvs as variables which are interpolated.
+func interpolatedVars(kvs []string) []envVar {
+	vars := make([]envVar, len(kvs))
+	for i, kv := range kvs {
+		vars[i] = envVar{kv: kv}
+	}
+	return vars
+}
+
+// literalVars returns kvs as variables which are used as is.
+func literalVars(kvs []string) []envVar {
+	vars := make([]envVar, len(kvs))
+	for i, kv := range kvs {
+		vars[i] = envVar{kv: kv, literal: true}
+	}
+	return vars
+}
 
 // PathListSeparator is a cross-platform path list separator. On Windows, PathListSeparator
 // is replacd by ";". On others, PathListSeparator is replaced by ":"
@@ -33,20 +81,67 @@ func init() {
 }
 
 // SetEnviron sets the environment for child processes. Note that
-// SetEnviron(Env, InheritParentEnv) is called once automatically.
+// SetEnviron(Env, InheritParentEnv) is called once automatically. Dotenv
+// files, the profile and command line variables are layered over it.
 func SetEnviron(envstr string, inheritParent bool) {
+	envMu.Lock()
+	defer envMu.Unlock()
+	environArgs = &environSource{envstr, inheritParent}
+	setEnviron(envstr, inheritParent)
+}
+
+// setEnviron builds the base environment. envMu must be held.
+func setEnviron(envstr string, inheritParent bool) {
+	var env []string
 	if inheritParent {
-		environ = os.Environ()
+		env = os.Environ()
 	} else {
-		environ = []string{}
+		env = []string{}
 	}
 
 	// merge in package Env
 	if envstr != "" {
 		for _, kv := range ParseStringEnv(envstr) {
-			upsertenv(&environ, kv)
+			upsertenv(&env, kv)
 		}
 	}
+
+	// merge in dotenv files
+	overlay(&env, dotenv)
+
+	// merge in the active profile
+	for _, kv := range activeProfile.env {
+		upsertenv(&env, kv)
+	}
+
+	// command line vars have the last say and are used as given
+	for _, kv := range cliEnv {
+		setenv(&env, kv)
+	}
+
+	environ = env
+}
+
+// baseEnviron returns the base environment, building it if needed. The
+// result must not be modified.
+func baseEnviron() []string {
+	envMu.RLock()
+	env := environ
+	envMu.RUnlock()
+	if env != nil {
+		return env
+	}
+
+	envMu.Lock()
+	defer envMu.Unlock()
+	if environ == nil {
+		if environArgs != nil {
+			setEnviron(environArgs.envstr, environArgs.inheritParent)
+		} else {
+			setEnviron(Env, InheritParentEnv)
+		}
+	}
+	return environ
 }
 
 var envvarRe = regexp.MustCompile(`\$(\w+|\{(\w+)\})`)
@@ -68,10 +163,11 @@ func interpolateEnv(env []string, kv string) string {
 	return kv
 }
 
-// Getenv environment variable from a string array.
+// Getenv gets an environment variable from the base environment of
+// commands, which includes Env, dotenv files, the profile and command line
+// variables.
 func Getenv(key string) string {
-	envvars := ParseStringEnv(Env)
-	return getEnv(envvars, key, true)
+	return getEnv(baseEnviron(), key, true)
 }
 
 func getEnv(env []string, key string, checkParent bool) string {
@@ -102,43 +198,52 @@ func splitKV(kv string) []string {
 
 // upsertenv updates or inserts a key=value pair into an environment.
 func upsertenv(env *[]string, kv string) {
+	if splitKV(kv) == nil {
+		return
+	}
+	setenv(env, interpolateEnv(*env, kv))
+}
+
+// setenv updates or inserts a key=value pair into an environment without
+// interpolating it.
+func setenv(env *[]string, kv string) {
 	pair := splitKV(kv)
 	if pair == nil {
 		return
 	}
 
-	set := false
 	for i, item := range *env {
 		ipair := splitKV(item)
 		if ipair[0] == pair[0] {
-			(*env)[i] = interpolateEnv(*env, kv)
-			set = true
-			break
+			(*env)[i] = kv
+			return
 		}
-
 	}
+	*env = append(*env, kv)
+}
 
-	if !set {
-		*env = append(*env, interpolateEnv(*env, kv))
+// overlay updates or inserts vars into an environment in order.
+func overlay(env *[]string, vars []envVar) {
+	for _, v := range vars {
+		if v.literal {
+			setenv(env, v.kv)
+		} else {
+			upsertenv(env, v.kv)
+		}
 	}
 }
 
 // EffectiveEnv is the effective environment for an exec function.
 func EffectiveEnv(funcEnv []string) []string {
+	return overlayEnv(interpolatedVars(funcEnv))
+}
 
-	if environ == nil {
-		SetEnviron(Env, InheritParentEnv)
-	}
-
-	env := make([]string, len(environ))
-	copy(env, environ)
-
-	// merge in func's env
-	if funcEnv != nil && len(funcEnv) > 0 {
-		for _, kv := range funcEnv {
-			upsertenv(&env, kv)
-		}
-	}
+// overlayEnv returns a copy of the base environment with vars overlaid.
+func overlayEnv(vars []envVar) []string {
+	base := baseEnviron()
+	env := make([]string, len(base))
+	copy(env, base)
+	overlay(&env, vars)
 	return env
 }
 
@@ -162,12 +267,30 @@ func ParseStringEnv(s string) []string {
 	return env
 }
 
-// parse environemnt variables from commandline
-func addToOSEnviron(argv []string) {
+// setCLIEnv parses environment variables from the command line. They are
+// applied to commands only and do not change the process environment.
+func setCLIEnv(argv []string) {
+	var env []string
 	for _, arg := range argv {
-		equals := strings.IndexRune(arg, '=')
-		if equals > 0 {
-			os.Setenv(arg[0:equals], arg[equals+1:])
+		if isEnvArg(arg) {
+			env = append(env, arg)
 		}
 	}
+
+	envMu.Lock()
+	cliEnv = env
+	environ = nil
+	envMu.Unlock()
+}
+
+// isEnvArg determines if a command line argument is a key=value pair. The
+// names of matrix sub-tasks like build[GOOS=linux] contain = too but are
+// tasks.
+func isEnvArg(arg string) bool {
+	equals := strings.IndexByte(arg, '=')
+	if equals <= 0 {
+		return false
+	}
+	bracket := strings.IndexByte(arg, '[')
+	return bracket < 0 || bracket > equals
 }
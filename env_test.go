@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"sync"
 	"testing"
 
 	"gopkg.in/stretchr/testify.v1/assert"
@@ -120,15 +121,14 @@ func TestInheritedRunEnv(t *testing.T) {
 	}
 }
 
-func TestAddToOSEnviron(t *testing.T) {
+func TestSetCLIEnv(t *testing.T) {
+	defer setCLIEnv(nil)
 	others := []string{"_foo", "_test_bar=bah", "_test_opts=a=b,c=d,*="}
-	assert.Equal(t, "", os.Getenv("_foo"))
+	setCLIEnv(others)
+	assert.Equal(t, "", Getenv("_foo"))
+	assert.Equal(t, "bah", Getenv("_test_bar"))
+	assert.Equal(t, "a=b,c=d,*=", Getenv("_test_opts"))
 	assert.Equal(t, "", os.Getenv("_test_bar"))
-	assert.Equal(t, "", os.Getenv("_test_opts"))
-	addToOSEnviron(others)
-	assert.Equal(t, "", os.Getenv("_foo"))
-	assert.Equal(t, "bah", os.Getenv("_test_bar"))
-	assert.Equal(t, "a=b,c=d,*=", os.Getenv("_test_opts"))
 }
 
 func TestEnvFromArgs(t *testing.T) {
@@ -139,13 +139,79 @@ func TestEnvFromArgs(t *testing.T) {
 	}
 
 	argv := []string{"foo", "a=b", "c=", "d=e=f,g=*"}
+	defer setCLIEnv(nil)
 	godoExit(tasks, argv, func(code int) {
-		assert.Equal(t, "b", os.Getenv("a"))
-		assert.Equal(t, "", os.Getenv("c"))
-		assert.Equal(t, "e=f,g=*", os.Getenv("d"))
-
-		os.Setenv("a", "")
-		os.Setenv("c", "")
-		os.Setenv("d", "")
+		assert.Equal(t, "b", Getenv("a"))
+		assert.Equal(t, "", Getenv("c"))
+		assert.Equal(t, "e=f,g=*", Getenv("d"))
+		assert.Equal(t, "", os.Getenv("a"))
 	})
 }
+
+func TestLiteralCLIEnv(t *testing.T) {
+	defer setCLIEnv(nil)
+	setCLIEnv([]string{"_test_pw=a$HOME::b"})
+	assert.Equal(t, "a$HOME::b", Getenv("_test_pw"))
+}
+
+func TestLiteralContextEnv(t *testing.T) {
+	if isWindows {
+		return
+	}
+	var output, value string
+	tasks := func(p *Project) {
+		p.Task("default", nil, func(c *Context) {
+			c.Setenv("_TEST_PW", "p$HOMEx::y")
+			output = c.BashOutput("echo -n $_TEST_PW")
+			value = c.Getenv("_TEST_PW")
+		})
+	}
+	runTask(tasks, "default")
+	assert.Equal(t, "p$HOMEx::y", output)
+	assert.Equal(t, "p$HOMEx::y", value)
+}
+
+func TestParallelContextEnv(t *testing.T) {
+	if isWindows {
+		return
+	}
+	var mu sync.Mutex
+	outputs := map[string]string{}
+	tasks := func(p *Project) {
+		names := P{}
+		for _, name := range []string{"a", "b", "c", "d"} {
+			name := name
+			names = append(names, name)
+			p.Task(name, nil, func(c *Context) {
+				c.Setenv("PARALLEL_VAR", name)
+				output := c.BashOutput("echo -n $PARALLEL_VAR")
+				mu.Lock()
+				outputs[name] = output + c.Getenv("PARALLEL_VAR")
+				mu.Unlock()
+			})
+		}
+		p.Task("default", names, nil)
+	}
+	runTask(tasks, "default")
+	assert.Equal(t, map[string]string{"a": "aa", "b": "bb", "c": "cc", "d": "dd"}, outputs)
+	assert.Equal(t, "", Getenv("PARALLEL_VAR"))
+}
+
+func TestSetEnvironInGododir(t *testing.T) {
+	defer func() {
+		setCLIEnv(nil)
+		SetEnviron("", true)
+	}()
+	var env []string
+	tasks := func(p *Project) {
+		SetEnviron("GODODIR_A=a", false)
+		p.Task("foo", nil, func(*Context) {
+			env = EffectiveEnv(nil)
+		})
+	}
+	code := execCLI(tasks, []string{"foo", "GODODIR_B=b"}, nil)
+	assert.Equal(t, 0, code)
+	// command line vars are layered over the environment set by the
+	// Gododir, which does not inherit the parent environment
+	assert.Equal(t, []string{"GODODIR_A=a", "GODODIR_B=b"}, env)
+}
@@ -0,0 +1,225 @@
+package godo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrTimeout is the cause of an ExecError for a command which was killed
+// because it ran longer than its timeout.
+//
+//		if errors.Is(err, do.ErrTimeout) { ... }
+var ErrTimeout = errors.New("timed out")
+
+// stderrTailLines is the number of lines of STDERR kept in an ExecError.
+const stderrTailLines = 20
+
+// stderrTailBytes bounds the STDERR kept for an ExecError.
+const stderrTailBytes = 16 * 1024
+
+// ExecError is the error of a command which could not be started or did not
+// exit successfully. It is set on Context.Error. Tasks return it wrapped
+// with the name of the task, so inspect it with errors.As.
+//
+//		var execErr *do.ExecError
+//		if errors.As(err, &execErr) && execErr.ExitCode == 1 { ... }
+type ExecError struct {
+	// Command is the command string with secrets masked.
+	Command string
+	// Argv is the executable and its arguments with secrets masked.
+	Argv []string
+	// Dir is the working directory.
+	Dir string
+	// Line is the line of the command string the command is on.
+	Line int
+	// ExitCode is the exit code, -1 if the command did not exit normally.
+	ExitCode int
+	// Signal is the signal which killed the command, if any.
+	Signal string
+	// Duration is how long the command ran.
+	Duration time.Duration
+	// Stderr is the tail of STDERR.
+	Stderr string
+	// Err is the cause, for example an *exec.ExitError, an *exec.Error for a
+	// missing executable or ErrTimeout.
+	Err error
+
+	// showLine adds the line to the message of commands parsed from a
+	// command string
+	showLine bool
+}
+
+func (e *ExecError) Error() string {
+	msg := fmt.Sprintf("`%s`: %s", e.Command, e.Err.Error())
+	if e.showLine {
+		return fmt.Sprintf("%s\nline=%d", msg, e.Line)
+	}
+	return msg
+}
+
+// Unwrap returns the cause for errors.Is and errors.As.
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
+
+// PanicError is the error of a task whose handler panicked.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value interface{}
+	// Stack is the stack trace of the panic.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n%s", e.Value, e.Stack)
+}
+
+// Unwrap returns the value passed to panic if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// MultiError is the error of a run which continued after tasks failed. See
+// the -k flag.
+type MultiError struct {
+	// Errors are the errors of each failed task.
+	Errors []error
+}
+
+func (e *MultiError) Error() string {
+	lines := []string{fmt.Sprintf("%d tasks failed", len(e.Errors))}
+	for _, err := range e.Errors {
+		lines = append(lines, err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Is determines if any of the errors of the failed tasks is target, so
+// errors.Is looks through a MultiError.
+func (e *MultiError) Is(target error) bool {
+	return anyIs(e.Errors, target)
+}
+
+// As finds the first error of the failed tasks which matches target, so
+// errors.As looks through a MultiError.
+func (e *MultiError) As(target interface{}) bool {
+	return anyAs(e.Errors, target)
+}
+
+// errorList is the error of a Context which failed more than once, for
+// example a command run after BashOutput failed.
+type errorList []error
+
+func (e errorList) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e errorList) Is(target error) bool {
+	return anyIs(e, target)
+}
+
+func (e errorList) As(target interface{}) bool {
+	return anyAs(e, target)
+}
+
+// anyIs determines if errors.Is holds for any of errs. Errors wrapping
+// several errors implement Is and As with it instead of Unwrap() []error,
+// which needs Go 1.20.
+func anyIs(errs []error, target error) bool {
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyAs sets target to the first of errs which errors.As matches.
+func anyAs(errs []error, target interface{}) bool {
+	for _, err := range errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinFailures combines the errors of failed tasks. Errors of a MultiError
+// are flattened and an error reported more than once is only kept once. It
+// returns nil if there are no errors and a single error as is.
+func joinFailures(errs ...error) error {
+	var failures []error
+	var add func(err error)
+	add = func(err error) {
+		if multi, ok := err.(*MultiError); ok {
+			for _, e := range multi.Errors {
+				add(e)
+			}
+			return
+		}
+		for _, failure := range failures {
+			if failure == err {
+				return
+			}
+		}
+		failures = append(failures, err)
+	}
+	for _, err := range errs {
+		if err != nil {
+			add(err)
+		}
+	}
+
+	switch len(failures) {
+	case 0:
+		return nil
+	case 1:
+		return failures[0]
+	}
+	return &MultiError{Errors: failures}
+}
+
+// tailBuffer keeps the last lines written to it, at most stderrTailBytes.
+type tailBuffer struct {
+	sync.Mutex
+	buf []byte
+}
+
+func (tb *tailBuffer) Write(p []byte) (int, error) {
+	tb.Lock()
+	defer tb.Unlock()
+	tb.buf = append(tb.buf, p...)
+	if over := len(tb.buf) - stderrTailBytes; over > 0 {
+		// drop whole lines so a secret is not cut in half before masking
+		cut := over
+		if i := bytes.IndexByte(tb.buf[over:], '\n'); i >= 0 {
+			cut += i + 1
+		}
+		tb.buf = append([]byte(nil), tb.buf[cut:]...)
+	}
+	return len(p), nil
+}
+
+func (tb *tailBuffer) String() string {
+	tb.Lock()
+	defer tb.Unlock()
+	return string(tb.buf)
+}
+
+// tailLines returns the last n lines of s.
+func tailLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,114 @@
+package godo
+
+import (
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestExecError(t *testing.T) {
+	if isWindows {
+		return
+	}
+	_, err := BashCommand("echo one >&2; echo two >&2; exit 3").Dir("test").Stderr(ioutil.Discard).Capture().Run(nil)
+	var execErr *ExecError
+	assert.True(t, errors.As(err, &execErr))
+	assert.Equal(t, 3, execErr.ExitCode)
+	assert.Equal(t, "bash", execErr.Argv[0])
+	assert.Contains(t, execErr.Dir, "test")
+	assert.Equal(t, "one\ntwo", execErr.Stderr)
+	assert.Equal(t, "`echo one >&2; echo two >&2; exit 3`: exit status 3", err.Error())
+	var exitErr *exec.ExitError
+	assert.True(t, errors.As(err, &exitErr))
+
+	_, err = CommandArgv("godo-does-not-exist").Run(nil)
+	assert.True(t, errors.As(err, &execErr))
+	assert.True(t, errors.Is(err, exec.ErrNotFound))
+	assert.Equal(t, -1, execErr.ExitCode)
+
+	_, err = Command("sleep 5").Timeout(10 * time.Millisecond).Run(nil)
+	assert.True(t, errors.Is(err, ErrTimeout))
+	assert.True(t, errors.As(err, &execErr))
+	assert.Equal(t, "killed", execErr.Signal)
+
+	defer resetSecrets()
+	_, err = BashCommand("exit 2 # " + Secret("s3cret")).Run(nil)
+	assert.Equal(t, "`exit 2 # ***`: exit status 2", err.Error())
+}
+
+func TestTaskExecError(t *testing.T) {
+	if isWindows {
+		return
+	}
+	tasks := func(p *Project) {
+		p.Task1("fail", func(c *Context) {
+			c.Bash("echo no such table >&2; exit 4")
+		})
+		p.Task("default", S{"fail"}, nil)
+	}
+	_, err := runTask(tasks, "default")
+	var execErr *ExecError
+	assert.True(t, errors.As(err, &execErr))
+	assert.Equal(t, 4, execErr.ExitCode)
+	assert.Equal(t, "no such table", execErr.Stderr)
+	assert.Equal(t, "\"default>fail\": `echo no such table >&2; exit 4`: exit status 4", err.Error())
+}
+
+func TestContextErrors(t *testing.T) {
+	if isWindows {
+		return
+	}
+	tasks := func(p *Project) {
+		p.Task1("fail", func(c *Context) {
+			c.BashOutput("exit 4")
+			c.RunOutput("bash -c 'exit 5'")
+			c.Bash("echo skipped")
+		})
+	}
+	_, err := runTask(tasks, "fail")
+	var execErr *ExecError
+	assert.True(t, errors.As(err, &execErr))
+	assert.Equal(t, 4, execErr.ExitCode)
+	assert.Contains(t, err.Error(), "`exit 4`: exit status 4\n`bash -c 'exit 5'`: exit status 5")
+}
+
+func TestErrorsIsAs(t *testing.T) {
+	first := errors.New("first")
+	execErr := &ExecError{ExitCode: 2, Err: first}
+	for _, err := range []error{
+		&MultiError{Errors: []error{errors.New("other"), execErr}},
+		&RetryError{Errors: []error{errors.New("other"), execErr}},
+		errorList{errors.New("other"), execErr},
+	} {
+		assert.True(t, errors.Is(err, first))
+		assert.False(t, errors.Is(err, ErrTimeout))
+		var target *ExecError
+		if assert.True(t, errors.As(err, &target)) {
+			assert.Equal(t, 2, target.ExitCode)
+		}
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	var tb tailBuffer
+	line := strings.Repeat("x", 1023) + "\n"
+	for i := 0; i < 20; i++ {
+		tb.Write([]byte(line))
+	}
+	tb.Write([]byte("last\n"))
+	assert.True(t, len(tb.String()) <= stderrTailBytes)
+	assert.True(t, strings.HasPrefix(tb.String(), "x"))
+	assert.True(t, strings.HasSuffix(tb.String(), line+"last\n"))
+}
+
+func TestTailLines(t *testing.T) {
+	assert.Equal(t, "", tailLines("", 2))
+	assert.Equal(t, "a", tailLines("a\n", 2))
+	assert.Equal(t, "b\nc", tailLines("a\nb\nc\n", 2))
+	assert.Equal(t, "a\nb", tailLines("a\nb", 2))
+}
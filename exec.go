@@ -7,16 +7,16 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/howeyc/gopass"
-	"github.com/mgutz/str"
 	"github.com/nozzle/throttler"
 	"gopkg.in/godo.v2/util"
 )
 
 // Bash executes a bash script (string).
 func Bash(script string, options ...map[string]interface{}) (string, error) {
-	return bash(script, options)
+	return bash(nil, script, options)
 }
 
 // BashOutput executes a bash script and returns the output
@@ -26,12 +26,12 @@ func BashOutput(script string, options ...map[string]interface{}) (string, error
 	} else {
 		options[0]["$out"] = CaptureBoth
 	}
-	return bash(script, options)
+	return bash(nil, script, options)
 }
 
 // Run runs a command.
 func Run(commandstr string, options ...map[string]interface{}) (string, error) {
-	return run(commandstr, options)
+	return run(nil, commandstr, options)
 }
 
 // RunOutput runs a command and returns output.
@@ -41,7 +41,7 @@ func RunOutput(commandstr string, options ...map[string]interface{}) (string, er
 	} else {
 		options[0]["$out"] = CaptureBoth
 	}
-	return run(commandstr, options)
+	return run(nil, commandstr, options)
 }
 
 // Start starts an async command. If executable has suffix ".go" then it will
@@ -51,29 +51,34 @@ func RunOutput(commandstr string, options ...map[string]interface{}) (string, er
 //
 // The working directory is optional.
 func Start(commandstr string, options ...map[string]interface{}) error {
-	return startEx(nil, commandstr, options)
+	return startEx(nil, commandOptions(Command(commandstr), options))
 }
 
 func rebuildPackage(filename string) error {
-	_, err := Run("go build", M{"$in": filepath.Dir(filename)})
+	_, err := Command("go build").Dir(filepath.Dir(filename)).run(nil)
 	return err
 }
 
-func startEx(context *Context, commandstr string, options []map[string]interface{}) error {
-	m, dir, _, err := parseOptions(options)
+func startEx(context *Context, b *CommandBuilder) error {
+	dir, err := resolveDir(b.dir)
 	if err != nil {
 		return err
 	}
-	if strings.Contains(commandstr, "{{") {
-		commandstr, err = util.StrTemplate(commandstr, m)
-		if err != nil {
-			return err
-		}
+	cmds, err := b.commands(context, dir)
+	if err != nil {
+		return err
+	}
+	if len(cmds) == 0 {
+		return fmt.Errorf("Empty command string")
+	}
+	cmd := cmds[0]
+	for _, more := range cmds[1:] {
+		cmd.argv = append(append(cmd.argv, more.executable), more.argv...)
 	}
-	executable, argv, env := splitCommand(commandstr)
+
 	if context != nil && context.FileEvent != nil {
 		event := context.FileEvent
-		absPath, err := filepath.Abs(filepath.Join(dir, executable))
+		absPath, err := filepath.Abs(filepath.Join(dir, cmd.executable))
 		if err != nil {
 			return err
 		}
@@ -91,41 +96,34 @@ func startEx(context *Context, commandstr string, options []map[string]interface
 			rebuildPackage(event.Path)
 		}
 	}
-	isGoFile := strings.HasSuffix(executable, ".go")
+	isGoFile := strings.HasSuffix(cmd.executable, ".go")
 	if isGoFile {
 		cmdstr := "go install"
 		if context == nil || context.FileEvent == nil {
 			util.Info(context.Task.Name, "rebuilding with -a to ensure clean build (might take awhile)\n")
 			cmdstr += " -a"
 		}
-		_, err = Run(cmdstr, m)
+		install := Command(cmdstr).Dir(dir)
+		install.data = b.data
+		_, err = install.run(context)
 		if err != nil {
 			return err
 		}
-		executable = filepath.Base(dir)
-	}
-	cmd := &command{
-		executable: executable,
-		wd:         dir,
-		env:        env,
-		argv:       argv,
-		commandstr: commandstr,
+		cmd.executable = filepath.Base(dir)
 	}
+	cmd.capture = 0
+	cmd.timeout = 0
 	return cmd.runAsync()
 }
 
-func getWorkingDir(m map[string]interface{}) (string, error) {
+// resolveDir resolves the working directory of a command. The default is
+// the current directory.
+func resolveDir(wd string) (string, error) {
 	pwd, err := os.Getwd()
 	if err != nil {
 		return "", nil
 	}
 
-	var wd string
-	if m != nil {
-		if d, ok := m["$in"].(string); ok {
-			wd = d
-		}
-	}
 	if wd != "" {
 		var path string
 		if filepath.IsAbs(wd) {
@@ -142,120 +140,60 @@ func getWorkingDir(m map[string]interface{}) (string, error) {
 	return pwd, nil
 }
 
-func parseOptions(options []map[string]interface{}) (m map[string]interface{}, dir string, capture int, err error) {
-	if options == nil {
-		m = map[string]interface{}{}
-	} else {
-		m = options[0]
-	}
-
-	dir, err = getWorkingDir(m)
-	if err != nil {
-		return nil, "", 0, err
-	}
-
-	if n, ok := m["$out"].(int); ok {
-		capture = n
-	}
-
-	return m, dir, capture, nil
-}
-
 // Bash executes a bash string. Use backticks for multiline. To execute as shell script,
 // use Run("bash script.sh")
-func bash(script string, options []map[string]interface{}) (output string, err error) {
-	m, dir, capture, err := parseOptions(options)
-	if err != nil {
-		return "", err
-	}
+func bash(context *Context, script string, options []map[string]interface{}) (output string, err error) {
+	result, err := commandOptions(BashCommand(script), options).run(context)
+	return result.Output, err
+}
 
-	if strings.Contains(script, "{{") {
-		script, err = util.StrTemplate(script, m)
-		if err != nil {
-			return "", err
-		}
-	}
+func run(context *Context, commandstr string, options []map[string]interface{}) (output string, err error) {
+	result, err := commandOptions(Command(commandstr), options).run(context)
+	return result.Output, err
+}
 
-	gcmd := &command{
-		executable: "bash",
-		argv:       []string{"-c", script},
-		wd:         dir,
-		capture:    capture,
-		commandstr: script,
-	}
+// Cmd runs executable with args as is. Unlike Run, no parsing, expansion or
+// templating is done so arguments never need quoting.
+//
+//		Cmd("git", "commit", "-m", msg)
+func Cmd(executable string, args ...string) error {
+	return cmdEx(nil, executable, args)
+}
 
-	return gcmd.run()
+func cmdEx(context *Context, executable string, args []string) error {
+	_, err := CommandArgv(executable, args...).run(context)
+	return err
 }
 
-func run(commandstr string, options []map[string]interface{}) (output string, err error) {
-	m, dir, capture, err := parseOptions(options)
+// splitCommand splits a command into its environment prefix, executable and
+// arguments. Newlines are treated as spaces. See SplitWords.
+func splitCommand(command string, getenv func(string) string) (executable string, argv, env []string, err error) {
+	commands, err := parseCommands(command, getenv)
 	if err != nil {
-		return "", err
-	}
-
-	if strings.Contains(commandstr, "{{") {
-		commandstr, err = util.StrTemplate(commandstr, m)
-		if err != nil {
-			return "", err
-		}
+		return
 	}
-
-	lines := strings.Split(commandstr, "\n")
-	if len(lines) == 0 {
-		return "", fmt.Errorf("Empty command string")
+	if len(commands) == 0 {
+		err = fmt.Errorf("Empty command string")
+		return
 	}
-	for i, cmdline := range lines {
-		cmdstr := strings.Trim(cmdline, " \t")
-		if cmdstr == "" {
-			continue
-		}
-		executable, argv, env := splitCommand(cmdstr)
-
-		cmd := &command{
-			executable: executable,
-			wd:         dir,
-			env:        env,
-			argv:       argv,
-			capture:    capture,
-			commandstr: commandstr,
-		}
-
-		s, err := cmd.run()
-		if err != nil {
-			err = fmt.Errorf(err.Error()+"\nline=%d", i)
-			return s, err
-		}
-		output += s
+	sc := commands[0]
+	for _, more := range commands[1:] {
+		sc.words = append(sc.words, more.words...)
 	}
-	return output, nil
+	return sc.split()
 }
 
-// func getWd(wd []In) (string, error) {
-// 	if len(wd) == 1 {
-// 		return wd[0][0], nil
-// 	}
-// 	return os.Getwd()
-// }
-
-func splitCommand(command string) (executable string, argv, env []string) {
-	argv = str.ToArgv(command)
-	for i, item := range argv {
-		if strings.Contains(item, "=") {
-			if env == nil {
-				env = []string{item}
-				continue
-			}
-			env = append(env, item)
-		} else {
-			executable = item
-			argv = argv[i+1:]
-			return
-		}
+// lookupEnv returns a func which gets variables from the environment of
+// commands run by context, which may be nil, with funcEnv overlaid.
+func lookupEnv(context *Context, funcEnv []string) func(string) string {
+	var vars []envVar
+	if context != nil {
+		vars = context.environ()
+	}
+	env := overlayEnv(append(vars, interpolatedVars(funcEnv)...))
+	return func(key string) string {
+		return getEnv(env, key, false)
 	}
-
-	executable = argv[0]
-	argv = argv[1:]
-	return
 }
 
 func toInt(s string) int {
@@ -294,35 +232,43 @@ func Prompt(prompt string) string {
 	return text
 }
 
-// PromptPassword prompts user for password input.
+// PromptPassword prompts user for password input. The password is
+// registered as a Secret.
 func PromptPassword(prompt string) string {
-	fmt.Printf(prompt)
+	fmt.Print(prompt)
 	b, err := gopass.GetPasswd()
 	if err != nil {
 		fmt.Println(err.Error())
 		return ""
 	}
-	return string(b)
+	return Secret(string(b))
 }
 
 // GoThrottle starts to run the given list of fns concurrently,
-// at most n fns at a time.
+// at most n fns at a time. No more fns are started once one fails, but the
+// running fns are waited for before returning.
 func GoThrottle(throttle int, fns ...func() error) error {
 	var err error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
 
 	// Create a new Throttler that will get 2 urls at a time
 	t := throttler.New(throttle, len(fns))
 	for _, fn := range fns {
+		wg.Add(1)
 		// Launch a goroutine to fetch the URL.
 		go func(f func() error) {
+			defer wg.Done()
 			err2 := f()
 			if err2 != nil {
+				mu.Lock()
 				err = err2
+				mu.Unlock()
 			}
 
 			// Let Throttler know when the goroutine completes
 			// so it can dispatch another worker
-			t.Done(err)
+			t.Done(err2)
 		}(fn)
 		// Pauses until a worker is available or all jobs have been completed
 		// Returning the total number of goroutines that have errored
@@ -332,5 +278,32 @@ func GoThrottle(throttle int, fns ...func() error) error {
 			break
 		}
 	}
+	wg.Wait()
 	return err
 }
+
+// goThrottleAll is like GoThrottle but runs every function even if some
+// fail. It returns the errors of all functions which failed.
+func goThrottleAll(throttle int, fns ...func() error) error {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, throttle)
+	errs := make([]error, len(fns))
+	for i, fn := range fns {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, f func() error) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = f()
+		}(i, fn)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err == errRunCancelled {
+			return err
+		}
+	}
+	return joinFailures(errs...)
+}
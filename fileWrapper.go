@@ -3,23 +3,25 @@ package godo
 import (
 	"bytes"
 	"fmt"
-	"os"
+	"io"
 
 	"github.com/mgutz/ansi"
 )
 
 type fileWrapper struct {
-	file      *os.File
+	file io.Writer
+	// buf holds the end of the output which may be the start of a secret
+	// while secrets are masked, since a secret may be split across writes
 	buf       *bytes.Buffer
 	readLines string
 
-	recorder *bytes.Buffer
+	recorder io.Writer
 
 	// Adds color to stdout & stderr if terminal supports it
 	colorStart string
 }
 
-func newFileWrapper(file *os.File, recorder *bytes.Buffer, color string) *fileWrapper {
+func newFileWrapper(file io.Writer, recorder io.Writer, color string) *fileWrapper {
 	streamer := &fileWrapper{
 		file:       file,
 		buf:        bytes.NewBufferString(""),
@@ -40,7 +42,7 @@ func (l *fileWrapper) Write(p []byte) (n int, err error) {
 }
 
 func (l *fileWrapper) WriteString(s string) (n int, err error) {
-	if n, err = l.recorder.WriteString(s); err != nil {
+	if n, err = io.WriteString(l.recorder, s); err != nil {
 		return
 	}
 
@@ -54,6 +56,34 @@ func (l *fileWrapper) Close() error {
 }
 
 func (l *fileWrapper) out(str string) (err error) {
+	if !hasSecrets() && l.buf.Len() == 0 {
+		return l.print(str)
+	}
+
+	l.buf.WriteString(str)
+	masked := Mask(l.buf.String())
+	// only the end which may be the start of a secret is held, so prompts
+	// and progress are shown without waiting for a newline
+	i := secretPrefixIndex(masked)
+	l.buf.Reset()
+	l.buf.WriteString(masked[i:])
+	if i == 0 {
+		return nil
+	}
+	return l.print(masked[:i])
+}
+
+// flush writes any buffered partial line.
+func (l *fileWrapper) flush() error {
+	if l.buf.Len() == 0 {
+		return nil
+	}
+	s := l.buf.String()
+	l.buf.Reset()
+	return l.print(Mask(s))
+}
+
+func (l *fileWrapper) print(str string) (err error) {
 
 	if l.colorStart != "" {
 		fmt.Fprint(l.file, l.colorStart)
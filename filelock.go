@@ -0,0 +1,177 @@
+package godo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/godo.v2/util"
+)
+
+// LockDir is the directory of the file locks which keep godo processes from
+// running the same task at the same time.
+var LockDir = filepath.Join("Gododir", ".godo", "locks")
+
+const (
+	// LockWait waits until another godo process releases a file lock.
+	LockWait time.Duration = -1
+	// LockFailFast fails right away if another godo process holds a file
+	// lock.
+	LockFailFast time.Duration = 0
+)
+
+// lockPoll is how often a held file lock is checked.
+var lockPoll = 100 * time.Millisecond
+
+// LockError is the error of a task which could not acquire a file lock held
+// by another godo process.
+type LockError struct {
+	// Path is the path of the lock file.
+	Path string
+	// PID is the process which holds the lock.
+	PID int
+	// Waited is how long the lock was waited for.
+	Waited time.Duration
+}
+
+func (e *LockError) Error() string {
+	if e.Waited > 0 {
+		return fmt.Sprintf("%s is locked by PID %d, gave up after %s", e.Path, e.PID, e.Waited)
+	}
+	return fmt.Sprintf("%s is locked by PID %d", e.Path, e.PID)
+}
+
+// fileLock configures a file lock.
+type fileLock struct {
+	// wait is LockWait, LockFailFast or how long to wait
+	wait time.Duration
+}
+
+// lockPath returns the path of the lock file for name.
+func lockPath(name string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r < 128 && (isNameChar(byte(r), false) || r == '-' || r == '.') {
+			return r
+		}
+		return '_'
+	}, name)
+	return filepath.Join(LockDir, safe+".lock")
+}
+
+// fileLockSems serialize the goroutines of this process which acquire a lock
+// file, by path
+var fileLockSems = struct {
+	sync.Mutex
+	m map[string]chan struct{}
+}{m: map[string]chan struct{}{}}
+
+func fileLockSem(path string) chan struct{} {
+	fileLockSems.Lock()
+	defer fileLockSems.Unlock()
+	sem := fileLockSems.m[path]
+	if sem == nil {
+		sem = make(chan struct{}, 1)
+		fileLockSems.m[path] = sem
+	}
+	return sem
+}
+
+// acquire acquires the lock file path for this process. The returned func
+// releases it. The lock is an advisory lock of the OS on the file, which is
+// released when the process exits, so a lock left behind by a process which
+// crashed is free. The file stays in place and names the PID of the holder.
+func (fl *fileLock) acquire(logName string, path string, inv *invocation) (release func(), err error) {
+	// goroutines of this process are serialized before the lock file
+	sem := fileLockSem(path)
+	select {
+	case sem <- struct{}{}:
+	case <-inv.cancelled:
+		return nil, errRunCancelled
+	}
+	defer func() {
+		if err != nil {
+			<-sem
+		}
+	}()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+		}
+	}()
+
+	start := time.Now()
+	logged := false
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			if err := writePID(f); err != nil {
+				unlockFile(f)
+				return nil, err
+			}
+			return func() {
+				f.Truncate(0)
+				unlockFile(f)
+				f.Close()
+				<-sem
+			}, nil
+		}
+
+		pid := lockHolder(path)
+		waited := time.Since(start)
+		switch {
+		case fl.wait == LockFailFast:
+			return nil, &LockError{Path: path, PID: pid}
+		case fl.wait > 0 && waited >= fl.wait:
+			return nil, &LockError{Path: path, PID: pid, Waited: waited}
+		}
+		if !logged {
+			util.Info(logName, "waiting for %s locked by PID %d\n", path, pid)
+			logged = true
+		}
+
+		timer := time.NewTimer(lockPoll)
+		select {
+		case <-timer.C:
+		case <-inv.cancelled:
+			timer.Stop()
+			return nil, errRunCancelled
+		}
+	}
+}
+
+// writePID replaces the contents of the locked file f with the PID of this
+// process.
+func writePID(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	return err
+}
+
+// lockHolder returns the PID in the lock file path, 0 if it is not known
+// yet.
+func lockHolder(path string) int {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(b)))
+	return pid
+}
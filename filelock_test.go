@@ -0,0 +1,101 @@
+package godo
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+// holdLock locks the lock file of name through another open file, like
+// another godo process would, and writes pid to it.
+func holdLock(t *testing.T, name string, pid int) (release func()) {
+	path := lockPath(name)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	assert.NoError(t, err)
+	locked, err := tryLockFile(f)
+	assert.NoError(t, err)
+	assert.True(t, locked)
+	_, err = f.WriteString(strconv.Itoa(pid) + "\n")
+	assert.NoError(t, err)
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}
+}
+
+func useLockDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "godo-locks")
+	assert.NoError(t, err)
+	old := LockDir
+	LockDir = dir
+	return func() {
+		LockDir = old
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFileLock(t *testing.T) {
+	defer useLockDir(t)()
+
+	ran := 0
+	tasks := func(p *Project) {
+		p.Task1("fast", func(*Context) { ran++ }).FileLock(LockFailFast)
+		p.Task1("timeout", func(*Context) { ran++ }).FileLock(150 * time.Millisecond)
+		p.Task1("wait", func(*Context) { ran++ }).FileLock(LockWait)
+	}
+
+	// another process with the same PID, e.g. in another container
+	pid := os.Getpid()
+	release := holdLock(t, "root:fast", pid)
+	_, err := runTask(tasks, "fast")
+	release()
+	var lockErr *LockError
+	assert.True(t, errors.As(err, &lockErr))
+	assert.Equal(t, pid, lockErr.PID)
+	assert.Contains(t, err.Error(), "locked by PID "+strconv.Itoa(pid))
+
+	release = holdLock(t, "root:timeout", 4242)
+	_, err = runTask(tasks, "timeout")
+	release()
+	assert.True(t, errors.As(err, &lockErr))
+	assert.True(t, lockErr.Waited >= 150*time.Millisecond)
+	assert.Equal(t, 0, ran)
+
+	release = holdLock(t, "root:wait", 4242)
+	time.AfterFunc(200*time.Millisecond, release)
+	start := time.Now()
+	_, err = runTask(tasks, "wait")
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) >= 200*time.Millisecond)
+	assert.Equal(t, 1, ran)
+	release = holdLock(t, "root:wait", 4242)
+	release()
+}
+
+func TestFileLockStale(t *testing.T) {
+	defer useLockDir(t)()
+
+	// a lock file left behind by a process which exited is not locked
+	path := lockPath("godo")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, ioutil.WriteFile(path, []byte("4242\n"), 0644))
+
+	ran := false
+	tasks := func(p *Project) {
+		p.FileLock(LockFailFast)
+		p.Task1("foo", func(*Context) {
+			b, _ := ioutil.ReadFile(path)
+			ran = string(b) == strconv.Itoa(os.Getpid())+"\n"
+		})
+	}
+	_, err := runTask(tasks, "foo")
+	assert.NoError(t, err)
+	assert.True(t, ran, "project lock is held by this process")
+}
@@ -5,31 +5,6 @@ type Handler interface {
 	Handle(*Context)
 }
 
-// // HandlerFunc is Handler adapter.
-// type handlerFunc func() error
-
-// // Handle implements Handler.
-// func (f handlerFunc) Handle(*Context) error {
-// 	return f()
-// }
-
-// // VoidHandlerFunc is a Handler adapter.
-// type voidHandlerFunc func()
-
-// // Handle implements Handler.
-// func (v voidHandlerFunc) Handle(*Context) error {
-// 	v()
-// 	return nil
-// }
-
-// // ContextHandlerFunc is a Handler adapter.
-// type contextHandlerFunc func(*Context) error
-
-// // Handle implements Handler.
-// func (c contextHandlerFunc) Handle(ctx *Context) error {
-// 	return c(ctx)
-// }
-
 // HandlerFunc is a Handler adapter.
 type HandlerFunc func(*Context)
 
@@ -37,3 +12,14 @@ type HandlerFunc func(*Context)
 func (f HandlerFunc) Handle(ctx *Context) {
 	f(ctx)
 }
+
+// ErrorHandlerFunc is a Handler adapter for handlers which return an error.
+// The error fails the task like Context.Error.
+type ErrorHandlerFunc func(*Context) error
+
+// Handle implements Handler.
+func (f ErrorHandlerFunc) Handle(ctx *Context) {
+	if err := f(ctx); err != nil {
+		ctx.fail(err)
+	}
+}
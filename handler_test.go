@@ -0,0 +1,103 @@
+package godo
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestErrorHandler(t *testing.T) {
+	errFoo := errors.New("foo failed")
+	result := ""
+	tasks := func(p *Project) {
+		p.Task1E("foo", func(c *Context) error {
+			return errFoo
+		})
+		p.TaskE("bar", S{"foo"}, func(c *Context) error {
+			result = "bar"
+			return nil
+		})
+	}
+	_, err := runTask(tasks, "bar")
+	assert.True(t, errors.Is(err, errFoo))
+	assert.Equal(t, `"bar>foo": foo failed`, err.Error())
+	assert.Equal(t, "", result)
+
+	// the returned error is added to Context.Error
+	errBar := errors.New("bar failed")
+	tasks = func(p *Project) {
+		p.Task1E("foo", func(c *Context) error {
+			c.Error = errFoo
+			return errBar
+		})
+	}
+	_, err = runTask(tasks, "foo")
+	assert.True(t, errors.Is(err, errFoo))
+	assert.True(t, errors.Is(err, errBar))
+
+	tasks = func(p *Project) {
+		p.Task1E("foo", func(c *Context) error {
+			c.Error = errFoo
+			return c.Error
+		})
+	}
+	_, err = runTask(tasks, "foo")
+	assert.Equal(t, `"foo": foo failed`, err.Error())
+}
+
+func TestPanicRecovered(t *testing.T) {
+	tasks := func(p *Project) {
+		p.Task1("foo", func(c *Context) {
+			var m map[string]int
+			m["boom"]++
+		})
+	}
+	_, err := runTask(tasks, "foo")
+	var panicErr *PanicError
+	assert.True(t, errors.As(err, &panicErr))
+	assert.Contains(t, err.Error(), "panic: assignment to entry in nil map")
+	assert.Contains(t, string(panicErr.Stack), "handler_test.go")
+}
+
+func TestKeepGoing(t *testing.T) {
+	keepGoing = true
+	defer func() {
+		keepGoing = false
+	}()
+
+	var mu sync.Mutex
+	ran := map[string]int{}
+	record := func(name string) {
+		mu.Lock()
+		ran[name]++
+		mu.Unlock()
+	}
+	tasks := func(p *Project) {
+		p.Task1("a", func(c *Context) {
+			record("a")
+			Halt("a failed")
+		})
+		p.Task1("b", func(c *Context) {
+			record("b")
+		})
+		p.Task1E("c", func(c *Context) error {
+			record("c")
+			return errors.New("c failed")
+		})
+		p.Task("d", S{"a"}, func(c *Context) {
+			record("d")
+		})
+		p.Task("default", S{"a", "b", P{"c", "d"}}, func(c *Context) {
+			record("default")
+		})
+	}
+	_, err := runTask(tasks, "default")
+	var multi *MultiError
+	assert.True(t, errors.As(err, &multi))
+	assert.Equal(t, 2, len(multi.Errors))
+	assert.Contains(t, err.Error(), "a failed")
+	assert.Contains(t, err.Error(), "c failed")
+	assert.Equal(t, map[string]int{"a": 1, "b": 1, "c": 1}, ran)
+}
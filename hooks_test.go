@@ -0,0 +1,163 @@
+package godo
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestFinally(t *testing.T) {
+	ran := []string{}
+	record := func(name string) func(*Context) {
+		return func(*Context) {
+			ran = append(ran, name)
+		}
+	}
+	tasks := func(p *Project) {
+		p.Task1("up", record("up"))
+		p.Task1("fail", func(*Context) {
+			ran = append(ran, "fail")
+			Halt("tests failed")
+		})
+		p.Task1("down", record("down"))
+		p.Task1("rmtmp", record("rmtmp"))
+		p.Task1("notify", record("notify"))
+		p.Task("integration", S{"up", "fail"}, record("integration")).
+			Finally("rmtmp", "down").
+			OnFailure("notify")
+	}
+	_, err := runTask(tasks, "integration")
+	assert.Equal(t, `"integration>fail": tests failed`, err.Error())
+	assert.Equal(t, []string{"up", "fail", "notify", "down", "rmtmp"}, ran)
+
+	ran = []string{}
+	tasks = func(p *Project) {
+		p.Task1("ok", record("ok")).Finally("down").OnFailure("notify")
+		p.Task1("down", record("down"))
+		p.Task1("notify", record("notify"))
+	}
+	_, err = runTask(tasks, "ok")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ok", "down"}, ran)
+}
+
+func TestFinallyFails(t *testing.T) {
+	tasks := func(p *Project) {
+		p.Task1("ok", func(*Context) {}).Finally("down")
+		p.Task1E("down", func(*Context) error {
+			return errors.New("down failed")
+		})
+	}
+	_, err := runTask(tasks, "ok")
+	assert.Equal(t, `"ok>down": down failed`, err.Error())
+}
+
+func TestFinallyCancelled(t *testing.T) {
+	ran := []string{}
+	tasks := func(p *Project) {
+		p.Task1("long", func(c *Context) {
+			c.inv.cancel()
+			c.Run("echo never")
+		}).Finally("down").OnFailure("notify")
+		p.Task1("down", func(*Context) { ran = append(ran, "down") })
+		p.Task1("notify", func(*Context) { ran = append(ran, "notify") })
+	}
+	_, err := runTask(tasks, "long")
+	assert.Equal(t, errRunCancelled, err)
+	assert.Equal(t, []string{"down"}, ran)
+}
+
+func TestProjectHooks(t *testing.T) {
+	ran := []string{}
+	record := func(name string) func(*Context) {
+		return func(*Context) {
+			ran = append(ran, name)
+		}
+	}
+	tasks := func(p *Project) {
+		p.Before("login")
+		p.After("logout", "report")
+		p.Task1("login", record("login"))
+		p.Task1("logout", record("logout"))
+		p.Task1("report", record("report"))
+		p.Task1("deploy", func(*Context) {
+			ran = append(ran, "deploy")
+			Halt("deploy failed")
+		})
+	}
+	_, err := runTask(tasks, "deploy")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"login", "deploy", "report", "logout"}, ran)
+}
+
+func TestFinallyShared(t *testing.T) {
+	Debounce = 2 * time.Second
+	defer func() {
+		Debounce = 100 * time.Millisecond
+	}()
+
+	cleanups := 0
+	tasks := func(p *Project) {
+		p.Task1("a", func(*Context) {}).Finally("cleanup")
+		p.Task1("b", func(*Context) {}).Finally("cleanup")
+		p.Task1("cleanup", func(*Context) { cleanups++ }).RunOnce = true
+		p.Task("default", S{"a", "b"}, nil).Finally("cleanup")
+	}
+	_, err := runTask(tasks, "default")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, cleanups)
+}
+
+func TestFinallySharedDependency(t *testing.T) {
+	trace := ""
+	record := func(s string) func(*Context) {
+		return func(*Context) {
+			trace += s
+		}
+	}
+	tasks := func(p *Project) {
+		// db outlasts Debounce, so b reaches it again after it ran
+		p.Task1("db", func(c *Context) {
+			trace += "D"
+			time.Sleep(2 * Debounce)
+		}).Finally("stop")
+		p.Task1("stop", record("S"))
+		p.Task("a", S{"db"}, record("A"))
+		p.Task("b", S{"db"}, record("B"))
+		p.Task("default", S{"a", "b"}, nil)
+	}
+	_, err := runTask(tasks, "default")
+	assert.NoError(t, err)
+	assert.Equal(t, "DSAB", trace)
+}
+
+func TestFinallyWaitsForParallel(t *testing.T) {
+	var mu sync.Mutex
+	ran := []string{}
+	record := func(name string) {
+		mu.Lock()
+		ran = append(ran, name)
+		mu.Unlock()
+	}
+	tasks := func(p *Project) {
+		p.Task1("fail", func(*Context) {
+			Halt("tests failed")
+		})
+		p.Task1("slow", func(*Context) {
+			time.Sleep(200 * time.Millisecond)
+			record("slow")
+		})
+		p.Task1("down", func(*Context) { record("down") })
+		p.Task1("more", func(*Context) {
+			time.Sleep(50 * time.Millisecond)
+		})
+		// fail stops the Parallel while slow is still running
+		p.Task("default", P{"fail", "slow", "more", "more"}, nil).Finally("down")
+	}
+	_, err := runTask(tasks, "default")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"slow", "down"}, ran)
+}
@@ -28,10 +28,27 @@ func init() {
 	// Debounce should be less han watch delay
 	Debounce = 100 * time.Millisecond
 	verbose = false
+
+	// keep the timings of test runs out of Gododir
+	dir, err := ioutil.TempDir("", "godo-timings")
+	if err != nil {
+		panic(err)
+	}
+	TimingsFile = filepath.Join(dir, "timings.json")
+}
+
+// resetTimings forgets the durations of previous test runs, so they do not
+// reorder the tasks of a Parallel.
+func resetTimings() {
+	timings.Lock()
+	timings.durations = map[string]time.Duration{}
+	timings.Unlock()
+	os.Remove(TimingsFile)
 }
 
 // Runs a project returning the error value from the task.
 func runTask(tasksFn func(*Project), name string) (*Project, error) {
+	resetTimings()
 	proj := NewProject(tasksFn, func(status int) {
 		//fmt.Println("exited with", status)
 		panic("exited with code" + strconv.Itoa(status))
@@ -53,6 +70,7 @@ func execCLI(tasksFn func(*Project), argv []string, customExitFn func(int)) int
 			customExitFn(status)
 		}
 	}
+	resetTimings()
 	godoExit(tasksFn, argv, exitFn)
 	return code
 }
@@ -0,0 +1,386 @@
+package godo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/godo.v2/watcher"
+)
+
+// errRunCancelled is returned by a run which was superseded by a newer
+// watch event.
+var errRunCancelled = errors.New("run cancelled")
+
+// invocation is the state of a single run of a task graph as seen by one
+// branch of it.
+type invocation struct {
+	*runState
+	// lane is the trace lane of the branch
+	lane int
+}
+
+// runState is the state of a run shared by its branches.
+type runState struct {
+	// event is the file event which triggered the run, nil unless watching.
+	event *watcher.FileEvent
+
+	// invalid are the tasks invalidated by event. All tasks run when nil.
+	invalid map[*Task]bool
+
+	// cancelled is closed when the run is superseded
+	cancelled chan struct{}
+	// done is closed when the run has finished
+	done chan struct{}
+	once sync.Once
+
+	// failed are the errors of tasks which failed in this run, so a task
+	// is not rerun by another dependent when continuing on error
+	failed map[*Task]error
+	// ran are the tasks which ran in this run
+	ran map[*Task]bool
+	// running are closed when the tasks running in this run finish
+	running map[*Task]chan struct{}
+	// spans are when the tasks of this run ran
+	spans []taskSpan
+	mu    sync.Mutex
+
+	// started is when the run started
+	started time.Time
+	// deps are the dependencies of tasks with LazyDeps resolved in this run
+	deps map[*Task]Series
+	// resolving serializes the resolution of LazyDeps
+	resolving sync.Mutex
+	// hook is the Finally, OnFailure or After task this run was started
+	// for, which runs even if it is RunOnce and already complete
+	hook *Task
+	// forced runs every task of the graph even if it is debounced or
+	// RunOnce and already complete, for runs started from the console
+	forced bool
+	// resubmit handles the event of a watch run again, for example when a
+	// task was debounced. nil unless watching.
+	resubmit func(e *watcher.FileEvent)
+	// waits are the tasks each task waits for while it runs its
+	// dependencies or reads the outputs of other tasks
+	waits map[*Task]map[*Task]int
+	// tracer records the spans of this run for --trace, nil unless tracing
+	tracer *tracer
+	// skipped are why the tasks reached in this run are skipped, "" for
+	// tasks which run
+	skipped map[*Task]string
+	// evaluating serializes the evaluation of conditions
+	evaluating sync.Mutex
+}
+
+func newInvocation(e *watcher.FileEvent) *invocation {
+	return &invocation{runState: &runState{
+		event:     e,
+		cancelled: make(chan struct{}),
+		done:      make(chan struct{}),
+		started:   time.Now(),
+	}}
+}
+
+// branch returns the view of the run for a branch on lane.
+func (inv *invocation) branch(lane int) *invocation {
+	return &invocation{runState: inv.runState, lane: lane}
+}
+
+// includes determines if task is part of this run.
+func (inv *invocation) includes(task *Task) bool {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	return inv.invalid == nil || inv.invalid[task]
+}
+
+// cancel cancels the run. Running commands are killed and pending tasks
+// are not started.
+func (inv *invocation) cancel() {
+	inv.once.Do(func() {
+		close(inv.cancelled)
+	})
+}
+
+func (inv *invocation) isCancelled() bool {
+	select {
+	case <-inv.cancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// failure returns the error of task if it already failed in this run.
+func (inv *invocation) failure(task *Task) error {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	return inv.failed[task]
+}
+
+// failures returns the tasks which failed in this run with their errors.
+func (inv *invocation) failures() map[*Task]error {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	failures := map[*Task]error{}
+	for task, err := range inv.failed {
+		failures[task] = err
+	}
+	return failures
+}
+
+// fail records the error of task.
+func (inv *invocation) fail(task *Task, err error) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if inv.failed == nil {
+		inv.failed = map[*Task]error{}
+	}
+	inv.failed[task] = err
+}
+
+// hasRun determines if task ran in this run.
+func (inv *invocation) hasRun(task *Task) bool {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	return inv.ran[task]
+}
+
+// setRan records that task ran.
+func (inv *invocation) setRan(task *Task) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if inv.ran == nil {
+		inv.ran = map[*Task]bool{}
+	}
+	inv.ran[task] = true
+}
+
+// record records when the handler of task ran as logName.
+func (inv *invocation) record(task *Task, logName string, start time.Time, err error) {
+	end := time.Now()
+	if err == nil {
+		timings.set(task.key(), end.Sub(start))
+	}
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.spans = append(inv.spans, taskSpan{logName: logName, start: start, end: end})
+}
+
+// skipReason returns why task is skipped in this run, or "" if it runs. The
+// conditions of task are evaluated once per run, first is false if they were
+// evaluated for another dependent.
+func (inv *invocation) skipReason(task *Task) (reason string, first bool) {
+	inv.evaluating.Lock()
+	defer inv.evaluating.Unlock()
+	if reason, ok := inv.skipped[task]; ok {
+		return reason, false
+	}
+	reason = task.skipReason()
+	if inv.skipped == nil {
+		inv.skipped = map[*Task]string{}
+	}
+	inv.skipped[task] = reason
+	return reason, true
+}
+
+// begin marks task as running in this run and returns the func which marks
+// it as finished. If task is already running, or it ran and reuse is set,
+// end is nil and running is closed once that run has finished.
+func (inv *invocation) begin(task *Task, reuse bool) (end func(), running <-chan struct{}) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if ch, ok := inv.running[task]; ok {
+		return nil, ch
+	}
+	if reuse && inv.ran[task] {
+		ch := make(chan struct{})
+		close(ch)
+		return nil, ch
+	}
+	if inv.running == nil {
+		inv.running = map[*Task]chan struct{}{}
+	}
+	ch := make(chan struct{})
+	inv.running[task] = ch
+	return func() {
+		inv.mu.Lock()
+		delete(inv.running, task)
+		inv.mu.Unlock()
+		close(ch)
+	}, nil
+}
+
+// cycle returns an error naming the chain of tasks if other waits for task,
+// directly or through other tasks, so task cannot wait for other.
+func (inv *invocation) cycle(task *Task, other *Task) error {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	chain := inv.waitChain(other, task, map[*Task]bool{})
+	if chain == nil {
+		return nil
+	}
+	names := []string{task.Name}
+	for _, t := range chain {
+		names = append(names, t.Name)
+	}
+	return fmt.Errorf("cycle: %s", strings.Join(names, " > "))
+}
+
+// wait records that task waits for others until done is called.
+func (inv *invocation) wait(task *Task, others ...*Task) (done func()) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if inv.waits == nil {
+		inv.waits = map[*Task]map[*Task]int{}
+	}
+	if inv.waits[task] == nil {
+		inv.waits[task] = map[*Task]int{}
+	}
+	for _, other := range others {
+		inv.waits[task][other]++
+	}
+	return func() {
+		inv.mu.Lock()
+		defer inv.mu.Unlock()
+		for _, other := range others {
+			if inv.waits[task][other]--; inv.waits[task][other] == 0 {
+				delete(inv.waits[task], other)
+			}
+		}
+	}
+}
+
+// waitChain returns the chain of tasks from task to target if task waits
+// for target, nil otherwise. inv.mu must be held.
+func (inv *invocation) waitChain(task *Task, target *Task, visited map[*Task]bool) []*Task {
+	if task == target {
+		return []*Task{task}
+	}
+	if visited[task] {
+		return nil
+	}
+	visited[task] = true
+	for next := range inv.waits[task] {
+		if chain := inv.waitChain(next, target, visited); chain != nil {
+			return append([]*Task{task}, chain...)
+		}
+	}
+	return nil
+}
+
+// rerun creates a run for the same event and tasks as inv.
+func (inv *invocation) rerun() *invocation {
+	next := newInvocation(inv.event)
+	next.tracer = inv.tracer
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if inv.invalid != nil {
+		next.invalid = map[*Task]bool{}
+		for task := range inv.invalid {
+			next.invalid[task] = true
+		}
+	}
+	return next
+}
+
+// finish marks the run as done.
+func (inv *invocation) finish() {
+	close(inv.done)
+}
+
+// newWatchInvocation creates a run for the graph of task name which only
+// includes the tasks invalidated by e.
+func (project *Project) newWatchInvocation(name string, e *watcher.FileEvent) *invocation {
+	inv := newInvocation(e)
+	inv.invalid = map[*Task]bool{}
+	project.invalidate(name, e.Path, inv.invalid, map[*Task]bool{})
+	return inv
+}
+
+// invalidate marks the tasks in the graph of name which must rerun because
+// path changed. A task is invalid if its Src matches path, if it has no Src
+// since its inputs are unknown, or if any of its dependencies are invalid.
+func (project *Project) invalidate(name string, path string, invalid map[*Task]bool, visited map[*Task]bool) bool {
+	proj, task, _ := project.mustTask(name)
+	if visited[task] {
+		return invalid[task]
+	}
+	visited[task] = true
+
+	// the inputs of LazyDeps are unknown until they are resolved
+	dirty := len(task.SrcGlobs) == 0 || matchesFile(task.srcRegexps(), path) || hasLazyDeps(task.dependencies)
+	for _, depname := range task.DependencyNames() {
+		if proj.invalidate(depname, path, invalid, visited) {
+			dirty = true
+		}
+	}
+
+	if dirty {
+		invalid[task] = true
+	}
+	return dirty
+}
+
+// dependencies returns the dependencies of task in inv with LazyDeps
+// resolved. The funcs of LazyDeps are called once per run. In a watch run,
+// the tasks they return are invalidated like any other dependency.
+func (project *Project) dependencies(task *Task, inv *invocation) Series {
+	if !hasLazyDeps(task.dependencies) {
+		return task.dependencies
+	}
+	inv.resolving.Lock()
+	defer inv.resolving.Unlock()
+	if deps, ok := inv.deps[task]; ok {
+		return deps
+	}
+	deps := Series(project.resolveLazy(task.dependencies, task.Name, inv))
+	if inv.deps == nil {
+		inv.deps = map[*Task]Series{}
+	}
+	inv.deps[task] = deps
+	return deps
+}
+
+// resolveLazy returns a copy of steps with LazyDeps resolved.
+func (project *Project) resolveLazy(steps []interface{}, parentName string, inv *invocation) []interface{} {
+	resolved := make([]interface{}, len(steps))
+	for i, step := range steps {
+		switch t := step.(type) {
+		default:
+			resolved[i] = step
+		case LazyDeps:
+			deps := t.resolve(parentName)
+			project.invalidateLazy(deps, inv)
+			resolved[i] = deps
+		case S:
+			resolved[i] = Series(project.resolveLazy(t, parentName, inv))
+		case Series:
+			resolved[i] = Series(project.resolveLazy(t, parentName, inv))
+		case P:
+			resolved[i] = Parallel(project.resolveLazy(t, parentName, inv))
+		case Parallel:
+			resolved[i] = Parallel(project.resolveLazy(t, parentName, inv))
+		}
+	}
+	return resolved
+}
+
+// invalidateLazy adds the tasks of resolved LazyDeps which must rerun to a
+// watch run.
+func (project *Project) invalidateLazy(deps Series, inv *invocation) {
+	if inv.invalid == nil || inv.event == nil {
+		return
+	}
+	invalid := map[*Task]bool{}
+	visited := map[*Task]bool{}
+	for _, name := range deps.names() {
+		project.invalidate(name, inv.event.Path, invalid, visited)
+	}
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	for task := range invalid {
+		inv.invalid[task] = true
+	}
+}
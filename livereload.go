@@ -0,0 +1,141 @@
+package godo
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+
+	"gopkg.in/godo.v2/util"
+)
+
+// LiveReloadAddr is the address of the live-reload server started in watch
+// mode when any task uses Task#LiveReload.
+var LiveReloadAddr = "localhost:35729"
+
+const (
+	reloadPage = "reload"
+	reloadCSS  = "css"
+)
+
+// liveReloadJS connects to the live-reload server and either reloads the
+// page or refreshes stylesheets in place.
+const liveReloadJS = `(function() {
+  var es = new EventSource("//%s/livereload");
+  es.onmessage = function(e) {
+    if (e.data !== "css") {
+      location.reload();
+      return;
+    }
+    var links = document.querySelectorAll('link[rel="stylesheet"]');
+    for (var i = 0; i < links.length; i++) {
+      var href = links[i].href.replace(/[?&]_livereload=\d+/, "");
+      links[i].href = href + (href.indexOf("?") < 0 ? "?" : "&") + "_livereload=" + Date.now();
+    }
+  };
+})();
+`
+
+// cssExts are extensions of files which only require a stylesheet refresh.
+var cssExts = map[string]bool{
+	".css":  true,
+	".less": true,
+	".sass": true,
+	".scss": true,
+	".styl": true,
+}
+
+// liveReloadServer pushes reload messages to browsers using server-sent
+// events.
+type liveReloadServer struct {
+	sync.Mutex
+	clients map[chan string]bool
+}
+
+var liveReload = &liveReloadServer{clients: map[chan string]bool{}}
+var liveReloadOnce sync.Once
+
+// LiveReloadScript returns the script tag to add to HTML pages which should
+// reload when a live-reload task is rebuilt.
+func LiveReloadScript() string {
+	return fmt.Sprintf(`<script src="//%s/livereload.js"></script>`, LiveReloadAddr)
+}
+
+// startLiveReload starts the live-reload server once.
+func startLiveReload() {
+	liveReloadOnce.Do(func() {
+		util.Info("livereload", "listening on %s\n", LiveReloadAddr)
+		go func() {
+			err := http.ListenAndServe(LiveReloadAddr, liveReload)
+			if err != nil {
+				util.Error("livereload", "%s\n", err.Error())
+			}
+		}()
+	})
+}
+
+// ServeHTTP implements http.Handler.
+func (lr *liveReloadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/livereload.js":
+		w.Header().Set("Content-Type", "application/javascript")
+		fmt.Fprintf(w, liveReloadJS, r.Host)
+	case "/livereload":
+		lr.stream(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (lr *liveReloadServer) stream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ch := make(chan string, 1)
+	lr.Lock()
+	lr.clients[ch] = true
+	lr.Unlock()
+	defer func() {
+		lr.Lock()
+		delete(lr.clients, ch)
+		lr.Unlock()
+	}()
+
+	for {
+		select {
+		case msg := <-ch:
+			fmt.Fprintf(w, "data: %s\n\n", msg)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// broadcast sends msg to all connected browsers.
+func (lr *liveReloadServer) broadcast(msg string) {
+	lr.Lock()
+	defer lr.Unlock()
+	for ch := range lr.clients {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+// reloadKind returns the kind of reload required by a change to path.
+func reloadKind(path string) string {
+	if cssExts[filepath.Ext(path)] {
+		return reloadCSS
+	}
+	return reloadPage
+}
@@ -0,0 +1,49 @@
+package godo
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestLiveReloadBroadcast(t *testing.T) {
+	lr := &liveReloadServer{clients: map[chan string]bool{}}
+	server := httptest.NewServer(lr)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/livereload")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	// wait for the client to register
+	for i := 0; i < 50; i++ {
+		lr.Lock()
+		n := len(lr.clients)
+		lr.Unlock()
+		if n > 0 {
+			break
+		}
+		<-time.After(10 * time.Millisecond)
+	}
+
+	lr.broadcast(reloadKind("public/css/app.scss"))
+	line, err := bufio.NewReader(res.Body).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "data: css", strings.TrimSpace(line))
+
+	res, err = http.Get(server.URL + "/livereload.js")
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, 200, res.StatusCode)
+}
+
+func TestReloadKind(t *testing.T) {
+	assert.Equal(t, reloadCSS, reloadKind("a/b.css"))
+	assert.Equal(t, reloadPage, reloadKind("a/b.go"))
+}
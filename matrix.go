@@ -0,0 +1,131 @@
+package godo
+
+import (
+	"sort"
+	"strings"
+
+	"gopkg.in/godo.v2/util"
+)
+
+// Axes are the parameters of a matrix task and their values.
+type Axes map[string][]string
+
+// Matrix adds a task for each combination of the values of axes, named like
+// build[GOARCH=amd64,GOOS=linux], and a task name which runs them all in
+// parallel. The handler gets the combination from Context#Matrix. The keys
+// of a sub-task name may be given in any order. Keys and values must not
+// contain the separators of task names, such as "," and ":". There must be
+// at least one axis and every axis must have values. If name ends with "?",
+// the task and its sub-tasks run once.
+//
+//		p.Matrix("build", do.Axes{
+//			"GOOS":   {"linux", "darwin"},
+//			"GOARCH": {"amd64", "arm64"},
+//		}, func(c *do.Context) {
+//			m := c.Matrix()
+//			do.Command("go build -o dist/app-{{.GOOS}}-{{.GOARCH}}").
+//				Env("GOOS="+m["GOOS"], "GOARCH="+m["GOARCH"]).
+//				Data("GOOS", m["GOOS"]).
+//				Data("GOARCH", m["GOARCH"]).
+//				Run(c)
+//		})
+//
+//		godo "build[GOOS=linux,GOARCH=arm64]"
+func (project *Project) Matrix(name string, axes Axes, handler func(*Context)) *Task {
+	if len(axes) == 0 {
+		util.Panic("godo", "Matrix %s has no axes\n", name)
+	}
+	for key, values := range axes {
+		if key == "" || strings.ContainsAny(key, "=,:[]") {
+			util.Panic("godo", "Matrix %s has an invalid axis %q\n", name, key)
+		}
+		if len(values) == 0 {
+			util.Panic("godo", "Matrix %s axis %s has no values\n", name, key)
+		}
+		for _, value := range values {
+			if strings.ContainsAny(value, ",:]") {
+				util.Panic("godo", "Matrix %s axis %s has an invalid value %q\n", name, key, value)
+			}
+		}
+	}
+
+	base := strings.TrimSuffix(name, "?")
+	runOnce := strings.TrimPrefix(name, base)
+	var subtasks Parallel
+	for _, combination := range axes.combinations() {
+		task := project.Task1(matrixName(base, combination)+runOnce, handler)
+		task.matrix = combination
+		subtasks = append(subtasks, task.Name)
+	}
+	return project.TaskD(name, subtasks)
+}
+
+// combinations returns every combination of the values of the axes.
+func (axes Axes) combinations() []map[string]string {
+	keys := make([]string, 0, len(axes))
+	for key := range axes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	combinations := []map[string]string{{}}
+	for _, key := range keys {
+		var next []map[string]string
+		for _, combination := range combinations {
+			for _, value := range axes[key] {
+				m := map[string]string{key: value}
+				for k, v := range combination {
+					m[k] = v
+				}
+				next = append(next, m)
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+// matrixName returns the name of the sub-task of name for combination. Keys
+// are sorted.
+func matrixName(name string, combination map[string]string) string {
+	keys := make([]string, 0, len(combination))
+	for key := range combination {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + combination[key]
+	}
+	return name + "[" + strings.Join(pairs, ",") + "]"
+}
+
+// canonicalMatrixName sorts the keys of a sub-task name like
+// build[GOOS=linux,GOARCH=amd64]. Other names are returned as is.
+func canonicalMatrixName(name string) string {
+	start := strings.IndexByte(name, '[')
+	if start < 0 || !strings.HasSuffix(name, "]") {
+		return name
+	}
+	combination := map[string]string{}
+	for _, pair := range strings.Split(name[start+1:len(name)-1], ",") {
+		kv := splitKV(strings.TrimSpace(pair))
+		if kv == nil {
+			return name
+		}
+		combination[kv[0]] = kv[1]
+	}
+	return matrixName(name[:start], combination)
+}
+
+// Matrix returns the combination of a sub-task created by Project#Matrix.
+// It is empty for other tasks.
+func (context *Context) Matrix() map[string]string {
+	m := map[string]string{}
+	if context.Task != nil {
+		for k, v := range context.Task.matrix {
+			m[k] = v
+		}
+	}
+	return m
+}
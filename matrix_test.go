@@ -0,0 +1,97 @@
+package godo
+
+import (
+	"sort"
+	"sync"
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestMatrix(t *testing.T) {
+	var mu sync.Mutex
+	built := []string{}
+	tasks := func(p *Project) {
+		p.Matrix("build", Axes{
+			"GOOS":   {"linux", "darwin"},
+			"GOARCH": {"amd64", "arm64"},
+		}, func(c *Context) {
+			m := c.Matrix()
+			mu.Lock()
+			built = append(built, m["GOOS"]+"/"+m["GOARCH"])
+			mu.Unlock()
+		})
+	}
+
+	proj, err := runTask(tasks, "build")
+	assert.NoError(t, err)
+	sort.Strings(built)
+	assert.Equal(t, []string{"darwin/amd64", "darwin/arm64", "linux/amd64", "linux/arm64"}, built)
+	assert.NotNil(t, proj.Tasks["build[GOARCH=arm64,GOOS=linux]"])
+
+	built = []string{}
+	_, err = runTask(tasks, "build[GOOS=linux,GOARCH=arm64]")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"linux/arm64"}, built)
+}
+
+func TestCanonicalMatrixName(t *testing.T) {
+	assert.Equal(t, "build", canonicalMatrixName("build"))
+	assert.Equal(t, "build[a=1,b=2]", canonicalMatrixName("build[b=2, a=1]"))
+	assert.Equal(t, "build[oops]", canonicalMatrixName("build[oops]"))
+	assert.Equal(t, map[string]string{}, (&Context{}).Matrix())
+}
+
+func TestMatrixCLI(t *testing.T) {
+	defer setCLIEnv(nil)
+	var mu sync.Mutex
+	ran := []string{}
+	tasks := func(p *Project) {
+		p.Matrix("build", Axes{
+			"GOOS":   {"linux", "darwin"},
+			"GOARCH": {"amd64", "arm64"},
+		}, func(c *Context) {
+			m := c.Matrix()
+			mu.Lock()
+			ran = append(ran, m["GOOS"]+"/"+m["GOARCH"]+" "+c.Getenv("MATRIX_CLI"))
+			mu.Unlock()
+		})
+		p.Task1("default", func(*Context) {
+			mu.Lock()
+			ran = append(ran, "default")
+			mu.Unlock()
+		})
+	}
+
+	code := execCLI(tasks, []string{"build[GOOS=linux,GOARCH=arm64]", "MATRIX_CLI=yes"}, nil)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, []string{"linux/arm64 yes"}, ran)
+}
+
+func TestMatrixInvalid(t *testing.T) {
+	for _, axes := range []Axes{{"GOOS": {"linux,darwin"}}, {"GOOS": {"a:b"}}, {"GO:OS": {"linux"}}, {}, {"GOOS": {}}} {
+		assert.Panics(t, func() {
+			NewProject(func(p *Project) {
+				p.Matrix("build", axes, func(*Context) {})
+			}, func(int) {}, nil)
+		})
+	}
+}
+
+func TestMatrixRunOnce(t *testing.T) {
+	tasks := func(p *Project) {
+		p.Matrix("build?", Axes{"GOOS": {"linux", "darwin"}}, func(*Context) {})
+	}
+	proj := NewProject(tasks, func(int) {}, nil)
+	assert.True(t, proj.Tasks["build"].RunOnce)
+	assert.True(t, proj.Tasks["build[GOOS=linux]"].RunOnce)
+	assert.Equal(t, []string{"build[GOOS=linux]", "build[GOOS=darwin]"}, proj.Tasks["build"].DependencyNames())
+}
+
+func TestIsEnvArg(t *testing.T) {
+	assert.True(t, isEnvArg("GOOS=linux"))
+	assert.True(t, isEnvArg("A=[x]"))
+	assert.False(t, isEnvArg("build[GOOS=linux]"))
+	assert.False(t, isEnvArg("build"))
+	assert.False(t, isEnvArg("=x"))
+}
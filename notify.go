@@ -0,0 +1,184 @@
+package godo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/godo.v2/util"
+)
+
+const (
+	// StatusFailed is the status of a watched task which failed.
+	StatusFailed = "failed"
+	// StatusRecovered is the status of a watched task which succeeded
+	// after having failed.
+	StatusRecovered = "recovered"
+)
+
+// Notification describes a change in status of a watched task.
+type Notification struct {
+	// Task is the name of the task which failed or recovered, including its
+	// namespace, e.g. "sub:lint".
+	Task string
+	// Status is StatusFailed or StatusRecovered.
+	Status string
+	// Err is the error which failed the task, nil on recovery.
+	Err error
+	// Time is when the run finished.
+	Time time.Time
+}
+
+// Notifier is notified when a watch-triggered run fails or recovers.
+type Notifier interface {
+	Notify(*Notification) error
+}
+
+// NotifierFunc is a Notifier adapter.
+type NotifierFunc func(*Notification) error
+
+// Notify implements Notifier.
+func (f NotifierFunc) Notify(n *Notification) error {
+	return f(n)
+}
+
+// Notify adds notifiers which are called when a task of the project or of
+// its namespaces fails or recovers in a watch-triggered run.
+func (project *Project) Notify(notifiers ...Notifier) {
+	project.Lock()
+	project.notifiers = append(project.notifiers, notifiers...)
+	project.Unlock()
+}
+
+// notify sends n to the notifiers of the project and of its parents.
+func (project *Project) notify(n *Notification) {
+	for ; project != nil; project = project.parent {
+		project.Lock()
+		notifiers := project.notifiers
+		project.Unlock()
+
+		for _, notifier := range notifiers {
+			if err := notifier.Notify(n); err != nil {
+				util.Error("notify", "%s\n", err.Error())
+			}
+		}
+	}
+}
+
+// TerminalNotifier rings the terminal bell on failure and updates the
+// terminal title with the status.
+type TerminalNotifier struct {
+	Out io.Writer
+}
+
+// NewTerminalNotifier creates a TerminalNotifier which writes to stdout.
+func NewTerminalNotifier() *TerminalNotifier {
+	return &TerminalNotifier{Out: os.Stdout}
+}
+
+// Notify implements Notifier.
+func (tn *TerminalNotifier) Notify(n *Notification) error {
+	title := fmt.Sprintf("godo: %s %s", n.Task, n.Status)
+	if n.Status == StatusFailed {
+		_, err := fmt.Fprintf(tn.Out, "\a\033]0;%s\007", title)
+		return err
+	}
+	_, err := fmt.Fprintf(tn.Out, "\033]0;%s\007", title)
+	return err
+}
+
+// taskStatus is an entry in the status file.
+type taskStatus struct {
+	Status string    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// StatusFileNotifier writes the status of every watched task as JSON to
+// a file which editors and shell prompts can read.
+type StatusFileNotifier struct {
+	Path string
+
+	mu       sync.Mutex
+	statuses map[string]*taskStatus
+}
+
+// NewStatusFileNotifier creates a StatusFileNotifier. The path defaults to
+// ".godo/status.json".
+func NewStatusFileNotifier(path string) *StatusFileNotifier {
+	if path == "" {
+		path = filepath.Join(".godo", "status.json")
+	}
+	return &StatusFileNotifier{Path: path, statuses: map[string]*taskStatus{}}
+}
+
+// Notify implements Notifier.
+func (sn *StatusFileNotifier) Notify(n *Notification) error {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+
+	status := &taskStatus{Status: n.Status, Time: n.Time}
+	if n.Err != nil {
+		status.Error = n.Err.Error()
+	}
+	sn.statuses[n.Task] = status
+
+	b, err := json.MarshalIndent(sn.statuses, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(sn.Path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(sn.Path, b, 0644)
+}
+
+// HookNotifier runs a command with the notification details in the
+// environment variables GODO_TASK, GODO_STATUS and GODO_ERROR.
+type HookNotifier struct {
+	Command string
+}
+
+// NewHookNotifier creates a HookNotifier which runs command.
+func NewHookNotifier(command string) *HookNotifier {
+	return &HookNotifier{Command: command}
+}
+
+// Notify implements Notifier.
+func (hn *HookNotifier) Notify(n *Notification) error {
+	errstr := ""
+	if n.Err != nil {
+		errstr = n.Err.Error()
+	}
+	vars := []string{
+		"GODO_TASK=" + n.Task,
+		"GODO_STATUS=" + n.Status,
+		"GODO_ERROR=" + errstr,
+	}
+	// the details are used as is, an error may contain $ or ::
+	hookEnv := EffectiveEnv(nil)
+	for _, kv := range vars {
+		setenv(&hookEnv, kv)
+	}
+	getenv := func(key string) string {
+		return getEnv(hookEnv, key, false)
+	}
+	executable, argv, env, err := splitCommand(hn.Command, getenv)
+	if err != nil {
+		return err
+	}
+	env = append(env, vars...)
+	cmd := &command{
+		executable: executable,
+		argv:       argv,
+		env:        literalVars(env),
+		commandstr: hn.Command,
+	}
+	_, err = cmd.run()
+	return err
+}
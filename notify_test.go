@@ -0,0 +1,108 @@
+package godo
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestStatusFileNotifier(t *testing.T) {
+	path := filepath.Join("tmp", "godo", "status.json")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	sn := NewStatusFileNotifier(path)
+	err := sn.Notify(&Notification{Task: "build", Status: StatusFailed, Err: errors.New("boom"), Time: time.Now()})
+	assert.NoError(t, err)
+
+	b, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	var m map[string]map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &m))
+	assert.Equal(t, "failed", m["build"]["status"])
+	assert.Equal(t, "boom", m["build"]["error"])
+
+	sn.Notify(&Notification{Task: "build", Status: StatusRecovered, Time: time.Now()})
+	b, _ = ioutil.ReadFile(path)
+	m = nil
+	json.Unmarshal(b, &m)
+	assert.Equal(t, "recovered", m["build"]["status"])
+	assert.Nil(t, m["build"]["error"])
+}
+
+func TestHookNotifier(t *testing.T) {
+	if isWindows {
+		return
+	}
+	path := filepath.Join("tmp", "hook.txt")
+	defer os.Remove(path)
+
+	hn := NewHookNotifier(`bash -c "echo -n $GODO_TASK $GODO_STATUS > ` + path + `"`)
+	err := hn.Notify(&Notification{Task: "build", Status: StatusFailed, Err: errors.New("boom")})
+	assert.NoError(t, err)
+
+	b, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "build failed", string(b))
+}
+
+func TestHookNotifierLiteralError(t *testing.T) {
+	if isWindows {
+		return
+	}
+	dir, err := ioutil.TempDir("", "godo-hook")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "hook.txt")
+
+	hn := NewHookNotifier(`bash -c 'echo -n "$GODO_ERROR" > ` + path + `'`)
+	err = hn.Notify(&Notification{Task: "build", Status: StatusFailed, Err: errors.New("no $HOME::here")})
+	assert.NoError(t, err)
+
+	b, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "no $HOME::here", string(b))
+}
+
+func TestNotifyFailedTask(t *testing.T) {
+	var mu sync.Mutex
+	var root, sub []string
+	record := func(list *[]string) Notifier {
+		return NotifierFunc(func(n *Notification) error {
+			mu.Lock()
+			*list = append(*list, n.Task+" "+n.Status)
+			mu.Unlock()
+			return nil
+		})
+	}
+	failing := true
+	tasks := func(p *Project) {
+		p.Notify(record(&root))
+		p.Use("sub", func(p *Project) {
+			p.Notify(record(&sub))
+			p.Task1("lint", func(*Context) {
+				if failing {
+					Halt("lint failed")
+				}
+			})
+		})
+		p.Task("default", S{"sub:lint"}, nil)
+	}
+	proj := NewProject(tasks, func(int) {}, nil)
+	run := func() {
+		inv := newInvocation(nil)
+		inv.forced = true
+		proj.watchRunner("default").start(inv)
+		<-inv.done
+	}
+
+	run()
+	failing = false
+	run()
+	assert.Equal(t, []string{"sub:lint failed", "sub:lint recovered"}, sub)
+	assert.Equal(t, []string{"sub:lint failed", "sub:lint recovered"}, root)
+}
@@ -0,0 +1,73 @@
+package godo
+
+import "fmt"
+
+// SetOutput publishes a value of the running task which other tasks read
+// with Output.
+//
+//		p.Task1("gitinfo", func(c *do.Context) {
+//			c.SetOutput("version", strings.TrimSpace(c.RunOutput("git describe --tags")))
+//		})
+func (context *Context) SetOutput(key string, value interface{}) {
+	context.Task.Lock()
+	defer context.Task.Unlock()
+	if context.Task.outputs == nil {
+		context.Task.outputs = M{}
+	}
+	context.Task.outputs[key] = value
+}
+
+// Output gets a value published by task name with SetOutput. If the task has
+// not run yet in this run, it runs first along with its dependencies, then
+// its outputs are reused for the rest of the run. If it is running, for
+// example in another branch of a Parallel, Output waits for it. A task which
+// ran once and is Complete is not run again. If the task fails, or it waits
+// for the task calling Output, the error is set on the context and nil is
+// returned.
+//
+//		p.Task("release", do.S{"gitinfo"}, func(c *do.Context) {
+//			version := c.OutputString("gitinfo", "version")
+//		})
+func (context *Context) Output(name string, key string) interface{} {
+	if context.Task == nil || context.Task.project == nil {
+		return nil
+	}
+	_, task, _ := context.Task.project.mustTask(name)
+	if inv := context.inv; inv != nil && task != context.Task && !(task.RunOnce && task.isComplete()) {
+		// the task may be running and waiting for this one
+		err := inv.cycle(context.Task, task)
+		if err == nil {
+			done := inv.wait(context.Task, task)
+			err = context.Task.project.runNamed(name, context.logName+">"+name, inv, false)
+			done()
+		}
+		if err != nil {
+			context.fail(err)
+			return nil
+		}
+	}
+
+	task.Lock()
+	defer task.Unlock()
+	return task.outputs[key]
+}
+
+// OutputString gets an output like Output and formats it as a string. It is
+// "" if the output is not set.
+func (context *Context) OutputString(name string, key string) string {
+	value := context.Output(name, key)
+	if value == nil {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(value)
+}
+
+// resetOutputs clears the outputs of the last run before the task runs.
+func (task *Task) resetOutputs() {
+	task.Lock()
+	defer task.Unlock()
+	task.outputs = nil
+}
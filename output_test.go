@@ -0,0 +1,122 @@
+package godo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestOutput(t *testing.T) {
+	runs := 0
+	got := []interface{}{}
+	tasks := func(p *Project) {
+		p.Task1("gitinfo", func(c *Context) {
+			runs++
+			c.SetOutput("version", "v1.2.3")
+			c.SetOutput("commits", 42)
+		})
+		p.Task1("release", func(c *Context) {
+			got = append(got, c.Output("gitinfo", "version"))
+		})
+		p.Task("changelog", S{"gitinfo"}, func(c *Context) {
+			got = append(got, c.OutputString("gitinfo", "commits"), c.Output("gitinfo", "missing"))
+		})
+		p.Task("default", S{"release", "changelog"}, nil)
+	}
+	_, err := runTask(tasks, "default")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, runs)
+	assert.Equal(t, []interface{}{"v1.2.3", "42", nil}, got)
+}
+
+func TestOutputFails(t *testing.T) {
+	ran := false
+	tasks := func(p *Project) {
+		p.Task1E("gitinfo", func(c *Context) error {
+			return errors.New("not a git repository")
+		})
+		p.Task1("release", func(c *Context) {
+			if c.Output("gitinfo", "version") == nil && c.Error != nil {
+				return
+			}
+			ran = true
+		})
+	}
+	_, err := runTask(tasks, "release")
+	assert.Equal(t, `"release": "release>gitinfo": not a git repository`, err.Error())
+	assert.False(t, ran)
+}
+
+func TestOutputRunning(t *testing.T) {
+	runs := 0
+	var version string
+	tasks := func(p *Project) {
+		p.Task1("gitinfo", func(c *Context) {
+			runs++
+			time.Sleep(50 * time.Millisecond)
+			c.SetOutput("version", "v1.2.3")
+		})
+		p.Task1("release", func(c *Context) {
+			time.Sleep(10 * time.Millisecond)
+			version = c.OutputString("gitinfo", "version")
+		})
+		p.Task("default", P{"gitinfo", "release"}, nil)
+	}
+	_, err := runTask(tasks, "default")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, runs)
+	assert.Equal(t, "v1.2.3", version)
+}
+
+func TestOutputRunsLikeOtherTasks(t *testing.T) {
+	ran := []string{}
+	tasks := func(p *Project) {
+		p.Task1("gitinfo", func(c *Context) {
+			ran = append(ran, "gitinfo")
+			c.SetOutput("version", "v1.2.3")
+		}).Finally("cleanup")
+		p.Task1("skipped", func(c *Context) {
+			ran = append(ran, "skipped")
+			c.SetOutput("version", "v0")
+		}).When(Predicate("never", func() bool { return false }))
+		p.Task1("cleanup", func(*Context) { ran = append(ran, "cleanup") })
+		p.Task1("release", func(c *Context) {
+			ran = append(ran, c.OutputString("gitinfo", "version"), c.OutputString("skipped", "version"))
+		})
+	}
+	_, err := runTask(tasks, "release")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gitinfo", "cleanup", "v1.2.3", ""}, ran)
+}
+
+func TestOutputCycle(t *testing.T) {
+	tasks := func(p *Project) {
+		p.Task1("a", func(c *Context) {
+			c.Output("b", "x")
+		})
+		p.Task1("b", func(c *Context) {
+			c.Output("a", "x")
+		})
+		p.Task("c", S{"d"}, nil)
+		p.Task1("d", func(c *Context) {
+			c.Output("c", "x")
+		})
+	}
+	for name, chain := range map[string]string{"a": "cycle: b > a > b", "c": "cycle: d > c > d"} {
+		done := make(chan error)
+		go func() {
+			_, err := runTask(tasks, name)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), chain)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("deadlocked")
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package godo
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pipeline connects the STDOUT of each command to the STDIN of the next
+// like a shell pipeline, without a shell. Create one with Pipe.
+//
+//		result, err := do.Pipe(
+//			do.Command("git log --oneline"),
+//			do.Command("grep fix"),
+//			do.CommandArgv("wc", "-l"),
+//		).StdoutTo("fixes.txt").Run(c)
+type Pipeline struct {
+	stages []*CommandBuilder
+}
+
+// PipelineResult is the outcome of a pipeline.
+type PipelineResult struct {
+	// Result is the result of the pipeline. ExitCode is the exit code of the
+	// last stage which failed, or 0, like bash's pipefail. Stdout and Output
+	// are captured from the last stage. Stderr is captured from all stages.
+	Result
+	// Stages are the results of each stage.
+	Stages []*Result
+}
+
+// Pipe creates a pipeline of commands. Each command must be a single line.
+func Pipe(stages ...*CommandBuilder) *Pipeline {
+	return &Pipeline{stages: stages}
+}
+
+func (p *Pipeline) first() *CommandBuilder {
+	return p.stages[0]
+}
+
+func (p *Pipeline) last() *CommandBuilder {
+	return p.stages[len(p.stages)-1]
+}
+
+// StdinFrom reads STDIN of the first command from a file, like < path.
+func (p *Pipeline) StdinFrom(path string) *Pipeline {
+	p.first().StdinFrom(path)
+	return p
+}
+
+// Stdin sets STDIN of the first command.
+func (p *Pipeline) Stdin(r io.Reader) *Pipeline {
+	p.first().Stdin(r)
+	return p
+}
+
+// StdoutTo writes STDOUT of the last command to a file, like > path.
+func (p *Pipeline) StdoutTo(path string) *Pipeline {
+	p.last().StdoutTo(path)
+	return p
+}
+
+// AppendTo appends STDOUT of the last command to a file, like >> path.
+func (p *Pipeline) AppendTo(path string) *Pipeline {
+	p.last().AppendTo(path)
+	return p
+}
+
+// Stdout sets STDOUT of the last command.
+func (p *Pipeline) Stdout(w io.Writer) *Pipeline {
+	p.last().Stdout(w)
+	return p
+}
+
+// Capture records STDOUT of the last command and STDERR of all commands in
+// the result.
+func (p *Pipeline) Capture() *Pipeline {
+	for _, stage := range p.stages {
+		stage.capture |= CaptureStderr
+	}
+	p.last().capture = CaptureBoth
+	return p
+}
+
+// Run runs the pipeline. Like CommandBuilder#Run, it is skipped when context
+// is in error, otherwise an error is also set on context.
+func (p *Pipeline) Run(context *Context) (*PipelineResult, error) {
+	if context != nil && context.Error != nil {
+		logVerbose(context.Task.Name, "Context is in error. Skipping: %s\n", Mask(p.String()))
+		return &PipelineResult{Result: Result{ExitCode: -1}}, context.Error
+	}
+	result, err := p.run(context)
+	if err != nil && context != nil {
+		context.fail(err)
+		context.failed = &result.Result
+	}
+	return result, err
+}
+
+// String returns the pipeline as a shell command.
+func (p *Pipeline) String() string {
+	commands := make([]string, len(p.stages))
+	for i, stage := range p.stages {
+		commands[i] = strings.TrimSpace(stage.commandstr)
+	}
+	return strings.Join(commands, " | ")
+}
+
+func (p *Pipeline) run(context *Context) (*PipelineResult, error) {
+	start := time.Now()
+	result := &PipelineResult{Result: Result{ExitCode: -1}}
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+	if len(p.stages) == 0 {
+		return result, fmt.Errorf("Empty pipeline")
+	}
+
+	var files []*os.File
+	defer func() {
+		closeFiles(files)
+	}()
+
+	cmds := make([]*command, len(p.stages))
+	for i, stage := range p.stages {
+		dir, err := resolveDir(stage.dir)
+		if err != nil {
+			return result, err
+		}
+		stageCmds, err := stage.commands(context, dir)
+		if err != nil {
+			return result, err
+		}
+		if len(stageCmds) != 1 {
+			return result, fmt.Errorf("pipeline stage %d must be a single command: %s", i+1, Mask(stage.commandstr))
+		}
+		redirects, err := stage.openRedirects(dir, stageCmds)
+		files = append(files, redirects...)
+		if err != nil {
+			return result, err
+		}
+		cmds[i] = stageCmds[0]
+		// stages are connected through processes
+		cmds[i].script = nil
+	}
+
+	// connect the stages. The pipe ends are closed in this process once
+	// the commands have started so readers see EOF when writers exit.
+	var pipes []*os.File
+	for i := 0; i < len(cmds)-1; i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			closeFiles(pipes)
+			return result, err
+		}
+		pipes = append(pipes, r, w)
+		if cmds[i].stdout == nil {
+			cmds[i].stdout = w
+		}
+		if cmds[i+1].stdin == nil {
+			cmds[i+1].stdin = r
+		}
+	}
+
+	execCmds := make([]*exec.Cmd, len(cmds))
+	for i, gcmd := range cmds {
+		cmd, err := gcmd.toExecCmd()
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err != nil {
+			closeFiles(pipes)
+			for _, started := range execCmds[:i] {
+				started.Process.Kill()
+				started.Wait()
+			}
+			return result, gcmd.execError(err)
+		}
+		execCmds[i] = cmd
+	}
+	closeFiles(pipes)
+
+	errs := make([]error, len(cmds))
+	outputs := make([]string, len(cmds))
+	durations := make([]time.Duration, len(cmds))
+	// a stage may exit before the stages in front of it
+	var wg sync.WaitGroup
+	for i, gcmd := range cmds {
+		wg.Add(1)
+		go func(i int, gcmd *command) {
+			defer wg.Done()
+			outputs[i], errs[i] = gcmd.wait(execCmds[i])
+			durations[i] = time.Since(gcmd.started)
+		}(i, gcmd)
+	}
+	wg.Wait()
+
+	var stderr []string
+	var failed error
+	result.ExitCode = 0
+	for i, gcmd := range cmds {
+		stage := &Result{
+			ExitCode: gcmd.exitCode,
+			Stdout:   Mask(gcmd.stdoutBuf.String()),
+			Stderr:   Mask(gcmd.stderrBuf.String()),
+			Output:   outputs[i],
+			Duration: durations[i],
+		}
+		result.Stages = append(result.Stages, stage)
+		stderr = append(stderr, stage.Stderr)
+		if errs[i] != nil {
+			// pipefail, the last failed stage sets the status
+			result.ExitCode = gcmd.exitCode
+			failed = fmt.Errorf("pipeline stage %d (%s): %w", i+1, Mask(p.stages[i].commandstr), errs[i])
+		}
+	}
+	last := result.Stages[len(result.Stages)-1]
+	result.Stdout = last.Stdout
+	result.Output = last.Output
+	result.Stderr = strings.Join(stderr, "")
+	return result, failed
+}
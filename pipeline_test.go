@@ -0,0 +1,99 @@
+package godo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestPipeline(t *testing.T) {
+	if isWindows {
+		return
+	}
+	dir, _ := ioutil.TempDir("", "godo-pipe")
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out.txt")
+
+	result, err := Pipe(
+		Command("cat test/foo.txt test/bar.txt"),
+		CommandArgv("tr", "a-z", "A-Z"),
+		Command("grep BAR"),
+	).StdoutTo(out).Run(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.ExitCode)
+	assert.Equal(t, 3, len(result.Stages))
+	b, _ := ioutil.ReadFile(out)
+	assert.Equal(t, "BAR\n", string(b))
+
+	_, err = Pipe(Command("echo again")).AppendTo(out).Run(nil)
+	assert.NoError(t, err)
+	b, _ = ioutil.ReadFile(out)
+	assert.Equal(t, "BAR\nagain\n", string(b))
+
+	result, err = Pipe(Command("cat")).StdinFrom(out).Stdout(&bytes.Buffer{}).Capture().Run(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "BAR\nagain\n", result.Stdout)
+}
+
+func TestPipelineFail(t *testing.T) {
+	if isWindows {
+		return
+	}
+	result, err := Pipe(
+		Command("bash -c 'echo x; exit 3'"),
+		Command("cat"),
+		Command("bash -c 'cat; exit 0'"),
+	).Stdout(&bytes.Buffer{}).Capture().Run(nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "stage 1")
+	assert.Equal(t, 3, result.ExitCode)
+	assert.Equal(t, 3, result.Stages[0].ExitCode)
+	assert.Equal(t, 0, result.Stages[2].ExitCode)
+	assert.Equal(t, "x\n", result.Stdout)
+
+	ran := false
+	tasks := func(p *Project) {
+		p.Task("foo", nil, func(c *Context) {
+			Pipe(Command("false"), Command("cat")).Run(c)
+			c.Run("true")
+			ran = c.Error == nil
+		})
+	}
+	_, err = runTask(tasks, "foo")
+	assert.Error(t, err)
+	assert.False(t, ran)
+}
+
+func TestPipelineStageDurations(t *testing.T) {
+	if isWindows {
+		return
+	}
+	// the first stage outlives the second
+	result, err := Pipe(
+		Command("sleep 0.3"),
+		Command("true"),
+	).Run(nil)
+	assert.NoError(t, err)
+	assert.True(t, result.Stages[0].Duration >= 300*time.Millisecond)
+	assert.True(t, result.Stages[1].Duration < result.Stages[0].Duration/2)
+}
+
+func TestRedirect(t *testing.T) {
+	if isWindows {
+		return
+	}
+	dir, _ := ioutil.TempDir("", "godo-redirect")
+	defer os.RemoveAll(dir)
+
+	_, err := Command("bash -c 'echo out; echo err >&2'").Dir(dir).StdoutTo("out.txt").StderrTo("err.txt").Run(nil)
+	assert.NoError(t, err)
+	b, _ := ioutil.ReadFile(filepath.Join(dir, "out.txt"))
+	assert.Equal(t, "out\n", string(b))
+	b, _ = ioutil.ReadFile(filepath.Join(dir, "err.txt"))
+	assert.Equal(t, "err\n", string(b))
+}
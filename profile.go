@@ -0,0 +1,182 @@
+package godo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mgutz/minimist"
+)
+
+// ProfilesFile is the config file, relative to the project directory, from
+// which profiles are loaded in addition to those defined in Go.
+var ProfilesFile = filepath.Join("Gododir", "profiles.json")
+
+// Profile is a named set of environment variables, template values and task
+// argument defaults which is selected with --profile.
+type Profile struct {
+	Name string
+	env  []string
+	vars M
+	args M
+}
+
+// activeProfile is the profile selected on the command line
+var activeProfile = newProfile("")
+
+func newProfile(name string) *Profile {
+	return &Profile{Name: name, vars: M{}, args: M{}}
+}
+
+// Env adds key=value pairs to the environment of all commands.
+func (profile *Profile) Env(kvs ...string) *Profile {
+	for _, kv := range kvs {
+		profile.env = append(profile.env, ParseStringEnv(kv)...)
+	}
+	return profile
+}
+
+// Var sets a value for the {{...}} templates of exec functions.
+func (profile *Profile) Var(key string, value interface{}) *Profile {
+	profile.vars[key] = value
+	return profile
+}
+
+// Arg sets the default value of a task argument.
+func (profile *Profile) Arg(key string, value interface{}) *Profile {
+	profile.args[key] = value
+	return profile
+}
+
+// Vars returns the template values of the profile.
+func (profile *Profile) Vars() M {
+	return profile.vars
+}
+
+// Profile defines or gets the named profile. Profiles are shared by all
+// namespaces of a project.
+//
+//		p.Profile("prod").
+//			Env("DEPLOY_HOST=prod.example.com").
+//			Var("bucket", "assets-prod").
+//			Arg("replicas", 3)
+func (project *Project) Profile(name string) *Profile {
+	for project.parent != nil {
+		project = project.parent
+	}
+	project.Lock()
+	defer project.Unlock()
+	if project.profiles == nil {
+		project.profiles = map[string]*Profile{}
+	}
+	profile := project.profiles[name]
+	if profile == nil {
+		profile = newProfile(name)
+		project.profiles[name] = profile
+	}
+	return profile
+}
+
+// profileConfig is a profile entry in ProfilesFile.
+type profileConfig struct {
+	Env  string `json:"env"`
+	Vars M      `json:"vars"`
+	Args M      `json:"args"`
+}
+
+// loadProfiles merges the profiles from ProfilesFile, if it exists, into the
+// profiles defined in Go.
+func (project *Project) loadProfiles() error {
+	b, err := ioutil.ReadFile(filepath.Join(wd, ProfilesFile))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var configs map[string]*profileConfig
+	if err = json.Unmarshal(b, &configs); err != nil {
+		return fmt.Errorf("%s: %s", ProfilesFile, err.Error())
+	}
+	for name, config := range configs {
+		profile := project.Profile(name).Env(config.Env)
+		for k, v := range config.Vars {
+			profile.Var(k, v)
+		}
+		for k, v := range config.Args {
+			profile.Arg(k, v)
+		}
+	}
+	return nil
+}
+
+// useProfile activates the named profile. An empty name clears the active
+// profile.
+func (project *Project) useProfile(name string) error {
+	if name == "" {
+		setActiveProfile(newProfile(""))
+		return nil
+	}
+	if err := project.loadProfiles(); err != nil {
+		return err
+	}
+	project.Lock()
+	profile := project.profiles[name]
+	project.Unlock()
+	if profile == nil {
+		return fmt.Errorf("profile %q is not defined", name)
+	}
+	setActiveProfile(profile)
+	return nil
+}
+
+// currentProfile returns the active profile.
+func currentProfile() *Profile {
+	envMu.RLock()
+	defer envMu.RUnlock()
+	return activeProfile
+}
+
+func setActiveProfile(profile *Profile) {
+	envMu.Lock()
+	activeProfile = profile
+	// rebuild lazily in EffectiveEnv
+	environ = nil
+	envMu.Unlock()
+}
+
+// profileArgs returns argm with the active profile's argument defaults for
+// any argument not given on the command line.
+func profileArgs(argm minimist.ArgMap) minimist.ArgMap {
+	profile := currentProfile()
+	if len(profile.args) == 0 {
+		return argm
+	}
+	args := minimist.ArgMap{}
+	for k, v := range profile.args {
+		args[k] = v
+	}
+	for k, v := range argm {
+		args[k] = v
+	}
+	return args
+}
+
+// templateData returns the template values for an exec function, which
+// are the active profile's values overridden by the options map.
+func templateData(m map[string]interface{}) map[string]interface{} {
+	profile := currentProfile()
+	if len(profile.vars) == 0 {
+		return m
+	}
+	data := map[string]interface{}{}
+	for k, v := range profile.vars {
+		data[k] = v
+	}
+	for k, v := range m {
+		data[k] = v
+	}
+	return data
+}
@@ -0,0 +1,68 @@
+package godo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestProfile(t *testing.T) {
+	if isWindows {
+		return
+	}
+	defer func() {
+		setActiveProfile(newProfile(""))
+		SetEnviron("", true)
+	}()
+
+	var name, output string
+	var replicas, region interface{}
+	tasks := func(p *Project) {
+		p.Profile("prod").
+			Env("PROFILE_HOST=prod.example.com").
+			Var("bucket", "assets-prod").
+			Arg("replicas", 3).
+			Arg("region", "us")
+		p.Task("deploy", nil, func(c *Context) {
+			name = c.Profile().Name
+			output = c.BashOutput("echo -n $PROFILE_HOST {{.bucket}}")
+			replicas = c.Args["replicas"]
+			region = c.Args["region"]
+		})
+	}
+
+	code := execCLI(tasks, []string{"--profile=prod", "deploy", "--", "--region=eu"}, nil)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "prod", name)
+	assert.Equal(t, "prod.example.com assets-prod", output)
+	assert.Equal(t, 3, replicas)
+	assert.Equal(t, "eu", region)
+	assert.Equal(t, "", os.Getenv("PROFILE_HOST"))
+}
+
+func TestProfileFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "godo-profile")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "Gododir"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, ProfilesFile), []byte(`{
+		"staging": {"env": "PROFILE_HOST=staging", "vars": {"bucket": "assets-staging"}}
+	}`), 0644)
+
+	oldwd := wd
+	wd = dir
+	defer func() {
+		wd = oldwd
+		setActiveProfile(newProfile(""))
+		SetEnviron("", true)
+	}()
+
+	project := NewProject(func(p *Project) {}, nil, nil)
+	assert.Error(t, project.useProfile("prod"))
+	assert.NoError(t, project.useProfile("staging"))
+	assert.Equal(t, "staging", currentProfile().Name)
+	assert.Equal(t, "assets-staging", templateData(nil)["bucket"])
+	assert.True(t, sliceContains(EffectiveEnv(nil), "PROFILE_HOST=staging"))
+}
@@ -1,6 +1,7 @@
 package godo
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"path/filepath"
@@ -51,6 +52,31 @@ type Project struct {
 	contextArgm minimist.ArgMap
 	cwatchTasks map[chan bool]bool
 
+	// paused ignores watch events when set
+	paused bool
+	// failure is the message of the last failed watch run
+	failure string
+	// notifiers are notified when a watched task fails or recovers
+	notifiers []Notifier
+	// profiles are the profiles selectable with --profile
+	profiles map[string]*Profile
+	// fileLock keeps other godo processes from running tasks of the project
+	// at the same time
+	fileLock *fileLock
+	// before and after are the tasks run before and after each run
+	before []string
+	after  []string
+	// resources are the semaphores of the resources used by tasks, only
+	// used on the root project
+	resources *resources
+	// watchRunners run the graphs of watched tasks by name
+	watchRunners map[string]*watchRunner
+	// exitCode is the code passed to Exit
+	exitCode int
+	// trace records the runs for --trace, nil unless tracing. Only used on
+	// the root project.
+	trace *tracer
+
 	parent *Project
 }
 
@@ -60,6 +86,7 @@ func NewProject(tasksFunc func(*Project), exitFn func(code int), argm minimist.A
 	project.Namespace = map[string]*Project{}
 	project.Namespace[""] = project
 	project.ns = "root"
+	project.resources = &resources{m: map[string]*resource{}}
 	project.exitFn = exitFn
 	project.contextArgm = argm
 	project.Define(tasksFunc)
@@ -70,7 +97,7 @@ func NewProject(tasksFunc func(*Project), exitFn func(code int), argm minimist.A
 // reset resets project state
 func (project *Project) reset() {
 	for _, task := range project.Tasks {
-		task.Complete = false
+		task.setComplete(false)
 	}
 	project.lastRun = map[string]time.Time{}
 }
@@ -120,7 +147,10 @@ func (project *Project) mustTask(name string) (*Project, *Task, string) {
 		taskName = parts[len(parts)-1]
 	}
 
+	taskName = canonicalMatrixName(taskName)
+	proj.Lock()
 	task := proj.Tasks[taskName]
+	proj.Unlock()
 	if task == nil {
 		util.Panic("ERR", `"%s" task is not defined`+"\n", name)
 	}
@@ -155,90 +185,216 @@ func (project *Project) debounce(task *Task) bool {
 
 // Run runs a task by name.
 func (project *Project) Run(name string) error {
-	return project.run(name, name, nil)
+	return project.runRoot(name, newInvocation(nil))
+}
+
+// FileLock keeps other godo processes from running tasks of the project at
+// the same time. The lock is held while tasks run, not while watching for
+// changes. See Task#FileLock.
+func (project *Project) FileLock(wait time.Duration) *Project {
+	for project.parent != nil {
+		project = project.parent
+	}
+	project.fileLock = &fileLock{wait: wait}
+	return project
+}
+
+// Before runs tasks names in order before every run of the project. If one
+// fails, the run fails.
+func (project *Project) Before(names ...string) *Project {
+	for project.parent != nil {
+		project = project.parent
+	}
+	project.before = append(project.before, names...)
+	return project
+}
+
+// After runs tasks names after every run of the project in reverse order,
+// even if the run fails or is interrupted.
+func (project *Project) After(names ...string) *Project {
+	for project.parent != nil {
+		project = project.parent
+	}
+	project.after = append(project.after, names...)
+	return project
+}
+
+// tracer returns the tracer of the root project, nil unless tracing.
+func (project *Project) tracer() *tracer {
+	for project.parent != nil {
+		project = project.parent
+	}
+	return project.trace
+}
+
+// runRoot runs task name and its dependencies, holding the lock of the
+// project if any. The before and after tasks of the project run around it.
+func (project *Project) runRoot(name string, inv *invocation) error {
+	if project.fileLock != nil && !dryRun {
+		release, err := project.fileLock.acquire(name, lockPath("godo"), inv)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	inv.tracer = project.tracer()
+	defer inv.tracer.span("run", name, time.Now(), inv.lane, nil)
+
+	var err error
+	if len(project.before) > 0 {
+		err = project.runSeries(toSteps(project.before), name, inv)
+	}
+	if err == nil {
+		err = project.run(name, name, inv)
+	}
+	return project.runHooks(nil, project.after, name, err, inv)
 }
 
-// RunWithEvent runs a task by name and adds FileEvent e to the context.
-func (project *Project) runWithEvent(name string, logName string, e *watcher.FileEvent) error {
-	return project.run(name, logName, e)
+func toSteps(names []string) []interface{} {
+	steps := make([]interface{}, len(names))
+	for i, name := range names {
+		steps[i] = name
+	}
+	return steps
 }
 
-func (project *Project) runTask(depName string, parentName string, e *watcher.FileEvent) error {
+func (project *Project) runTask(depName string, parentName string, inv *invocation) error {
 	proj, _, taskName := project.mustTask(depName)
 
 	if proj == nil {
 		return fmt.Errorf("Project was not loaded for \"%s\" task", parentName)
 	}
-	return proj.runWithEvent(taskName, parentName+">"+depName, e)
+	return proj.run(taskName, parentName+">"+depName, inv)
 }
 
-func (project *Project) runParallel(steps []interface{}, parentName string, e *watcher.FileEvent) error {
+func (project *Project) runParallel(steps []interface{}, parentName string, inv *invocation) error {
+	defer inv.tracer.span("parallel", "parallel", time.Now(), inv.lane, M{"parent": parentName})
+	// each branch runs on a trace lane of its own while the others run
+	lanes := inv.tracer.branchLanes(inv.lane)
+	defer lanes.close()
+	branch := func(run func(inv *invocation) error) func() error {
+		return func() error {
+			lane := lanes.take()
+			defer lanes.put(lane)
+			return run(inv.branch(lane))
+		}
+	}
 	var funcs = []func() error{}
-	for _, step := range steps {
+	for _, step := range project.byCriticalPath(steps, inv) {
 		switch t := step.(type) {
 		default:
-			panic(parentName + ": Parallel flow can only have types: (string | Series | Parallel)")
+			panic(parentName + ": Parallel flow can only have types: (string | Series | Parallel | LazyDeps)")
 		case string:
-			funcs = append(funcs, func() error {
-				return project.runTask(t, parentName, e)
-			})
+			funcs = append(funcs, branch(func(inv *invocation) error {
+				return project.runTask(t, parentName, inv)
+			}))
 		case S:
-			funcs = append(funcs, func() error {
-				return project.runSeries(t, parentName, e)
-			})
+			funcs = append(funcs, branch(func(inv *invocation) error {
+				return project.runSeries(t, parentName, inv)
+			}))
 		case Series:
-			funcs = append(funcs, func() error {
-				return project.runSeries(t, parentName, e)
-			})
+			funcs = append(funcs, branch(func(inv *invocation) error {
+				return project.runSeries(t, parentName, inv)
+			}))
 		case P:
-			funcs = append(funcs, func() error {
-				return project.runParallel(t, parentName, e)
-			})
+			funcs = append(funcs, branch(func(inv *invocation) error {
+				return project.runParallel(t, parentName, inv)
+			}))
 		case Parallel:
-			funcs = append(funcs, func() error {
-				return project.runParallel(t, parentName, e)
-			})
+			funcs = append(funcs, branch(func(inv *invocation) error {
+				return project.runParallel(t, parentName, inv)
+			}))
+		case LazyDeps:
+			funcs = append(funcs, branch(func(inv *invocation) error {
+				return project.runSeries(t.resolve(parentName), parentName, inv)
+			}))
 		}
 	}
+	if keepGoing {
+		return goThrottleAll(3, funcs...)
+	}
 	err := GoThrottle(3, funcs...)
 	return err
 }
 
-func (project *Project) runSeries(steps []interface{}, parentName string, e *watcher.FileEvent) error {
+func (project *Project) runSeries(steps []interface{}, parentName string, inv *invocation) error {
+	if len(steps) > 1 {
+		defer inv.tracer.span("series", "series", time.Now(), inv.lane, M{"parent": parentName})
+	}
 	var err error
+	var failures []error
 	for _, step := range steps {
+		if inv.isCancelled() {
+			return errRunCancelled
+		}
 		switch t := step.(type) {
 		default:
-			panic(parentName + ": Series can only have types: (string | Series | Parallel)")
+			panic(parentName + ": Series can only have types: (string | Series | Parallel | LazyDeps)")
 		case string:
-			err = project.runTask(t, parentName, e)
+			err = project.runTask(t, parentName, inv)
 		case S:
-			err = project.runSeries(t, parentName, e)
+			err = project.runSeries(t, parentName, inv)
 		case Series:
-			err = project.runSeries(t, parentName, e)
+			err = project.runSeries(t, parentName, inv)
 		case P:
-			err = project.runParallel(t, parentName, e)
+			err = project.runParallel(t, parentName, inv)
 		case Parallel:
-			err = project.runParallel(t, parentName, e)
+			err = project.runParallel(t, parentName, inv)
+		case LazyDeps:
+			err = project.runSeries(t.resolve(parentName), parentName, inv)
 		}
-		if err != nil {
+		if err == errRunCancelled || err != nil && !keepGoing {
 			return err
 		}
+		failures = append(failures, err)
 	}
-	return nil
+	return joinFailures(failures...)
 }
 
 // run runs the project, executing any tasks named on the command line.
-func (project *Project) run(name string, logName string, e *watcher.FileEvent) error {
+func (project *Project) run(name string, logName string, inv *invocation) error {
+	return project.runNamed(name, logName, inv, true)
+}
+
+// runNamed runs task name with its dependencies and hooks unless it is
+// skipped. A run which closely follows the previous one is debounced if
+// debounce is set.
+func (project *Project) runNamed(name string, logName string, inv *invocation, debounce bool) error {
 	proj, task, _ := project.mustTask(name)
+	e := inv.event
+
+	if inv.isCancelled() {
+		return errRunCancelled
+	}
+
+	// tasks not affected by a watch event are skipped
+	if !inv.includes(task) {
+		logVerbose(logName, "unaffected by %s\n", e.Path)
+		return nil
+	}
+
+	// a task which failed is not rerun by another dependent
+	if err := inv.failure(task); err != nil {
+		return err
+	}
 
 	if !task.shouldRun(e) {
 		return nil
 	}
 
+	// conditions are checked before debounce, so a skipped task does not
+	// debounce the next run
+	if reason, first := inv.skipReason(task); reason != "" {
+		if first {
+			util.Info(logName, "skipped (%s)\n", reason)
+		}
+		return nil
+	}
+
 	// debounce needs to be separate from shouldRun, so we can enqueue
 	// a file event that arrives between debounce intervals
-	if proj.debounce(task) {
+	if debounce && !inv.forced && proj.debounce(task) {
 		if task.shouldRun(e) {
 			task.Lock()
 			if !task.ignoreEvents {
@@ -249,7 +405,12 @@ func (project *Project) run(name string, logName string, e *watcher.FileEvent) e
 					task.Lock()
 					task.ignoreEvents = false
 					task.Unlock()
-					project.run(name, logName, e)
+					if inv.resubmit != nil {
+						// a watch run replaces the in-flight one
+						inv.resubmit(inv.event)
+						return
+					}
+					project.run(name, logName, inv.rerun())
 				})
 			}
 			task.Unlock()
@@ -258,31 +419,155 @@ func (project *Project) run(name string, logName string, e *watcher.FileEvent) e
 		return nil
 	}
 
+	start := time.Now()
+	ran, err := proj.runWithDeps(task, name, logName, inv)
+	if !ran {
+		// the hooks run with the run which ran the task
+		return err
+	}
+	inv.tracer.span("task", logName, start, inv.lane, traceArgs(task, err))
+	return proj.runHooks(task.onFailure, task.finally, logName, err, inv)
+}
+
+// runWithDeps runs the dependencies of task then task. A task runs at most
+// once in inv. If it is already running or ran, that run is waited for
+// instead and ran is false.
+func (project *Project) runWithDeps(task *Task, name string, logName string, inv *invocation) (ran bool, err error) {
+	end, running := inv.begin(task, true)
+	if end == nil {
+		<-running
+		return false, inv.failure(task)
+	}
+	defer end()
+	return true, project.runDepsThenTask(task, name, logName, inv)
+}
+
+// runDepsThenTask runs the dependencies of task then task.
+func (project *Project) runDepsThenTask(task *Task, name string, logName string, inv *invocation) error {
 	// run dependencies first
-	err := proj.runSeries(task.dependencies, name, e)
+	deps := project.dependencies(task, inv)
+	var depTasks []*Task
+	for _, depName := range deps.names() {
+		_, dep, _ := project.mustTask(depName)
+		depTasks = append(depTasks, dep)
+	}
+	done := inv.wait(task, depTasks...)
+	err := project.runSeries(deps, name, inv)
+	done()
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		if task.Handler != nil {
+			util.Info(logName, "would run\n")
+		}
+		return nil
+	}
+
+	// then run the task itself once its resources are free
+	release, err := project.acquire(task, inv)
 	if err != nil {
 		return err
 	}
+	if task.fileLock != nil {
+		releaseFile, err := task.fileLock.acquire(logName, lockPath(project.ns+":"+task.Name), inv)
+		if err != nil {
+			release()
+			return err
+		}
+		defer releaseFile()
+	}
+	err = task.run(logName, inv)
+	release()
+	if err != nil && err != errRunCancelled {
+		inv.fail(task, err)
+	}
+	if err == nil {
+		inv.setRan(task)
+	}
+	return err
+}
+
+// runHooks runs the onFailure tasks if a run failed with err, then the
+// finally tasks. Each list runs in reverse order. Hooks run with their own
+// invocation on the trace lane of inv so they also run after the run was
+// cancelled, and they run each
+// time even if they ran before. The error of a failed hook is added to err.
+func (project *Project) runHooks(onFailure, finally []string, logName string, err error, inv *invocation) error {
+	var hooks []string
+	if err != nil && err != errRunCancelled {
+		hooks = append(hooks, reversed(onFailure)...)
+	}
+	hooks = append(hooks, reversed(finally)...)
+	if len(hooks) == 0 {
+		return err
+	}
 
-	// then run the task itself
-	return task.RunWithEvent(logName, e)
+	errs := []error{err}
+	for _, hook := range hooks {
+		if hookErr := project.runHook(hook, logName, inv.lane); hookErr != nil {
+			errs = append(errs, hookErr)
+		}
+	}
+	if err == errRunCancelled {
+		return err
+	}
+	return joinFailures(errs...)
 }
 
-// usage returns a string for usage screen
-func (project *Project) usage() string {
-	tasks := "Tasks:\n"
+// runHook runs the hook task name and its dependencies. Unlike run, the hook
+// is not debounced and runs even if it is RunOnce and already complete.
+func (project *Project) runHook(name string, parentName string, lane int) error {
+	proj, task, taskName := project.mustTask(name)
+	if proj == nil {
+		return fmt.Errorf("Project was not loaded for \"%s\" task", parentName)
+	}
+	logName := parentName + ">" + name
+	if reason := task.skipReason(); reason != "" {
+		util.Info(logName, "skipped (%s)\n", reason)
+		return nil
+	}
+	inv := newInvocation(nil).branch(lane)
+	inv.hook = task
+	inv.tracer = project.tracer()
+	start := time.Now()
+	_, err := proj.runWithDeps(task, taskName, logName, inv)
+	inv.tracer.span("task", logName, start, inv.lane, traceArgs(task, err))
+	return err
+}
+
+func reversed(names []string) []string {
+	result := make([]string, len(names))
+	for i, name := range names {
+		result[len(names)-1-i] = name
+	}
+	return result
+}
+
+// allTasks returns the sorted names of all tasks including namespaced tasks.
+func (project *Project) allTasks() ([]string, map[string]*Task) {
 	names := []string{}
 	m := map[string]*Task{}
 	for ns, proj := range project.Namespace {
 		if ns != "" {
 			ns += ":"
 		}
+		proj.Lock()
 		for _, task := range proj.Tasks {
 			names = append(names, ns+task.Name)
 			m[ns+task.Name] = task
 		}
+		proj.Unlock()
 	}
 	sort.Strings(names)
+	return names, m
+}
+
+// usage returns a string for usage screen
+func (project *Project) usage() string {
+	tasks := "Tasks:\n"
+	names, m := project.allTasks()
 	longest := 0
 	for _, name := range names {
 		l := len(name)
@@ -316,6 +601,16 @@ func (project *Project) Use(namespace string, tasksFunc func(*Project)) {
 	proj.parent = project
 }
 
+// addTask adds task to the project. Tasks may be added while tasks run, for
+// example from a DepsFunc.
+func (project *Project) addTask(task *Task) *Task {
+	project.Lock()
+	defer project.Unlock()
+	task.project = project
+	project.Tasks[task.Name] = task
+	return task
+}
+
 // Task adds a task to the project with dependencies and handler.
 func (project *Project) Task(name string, dependencies Dependency, handler func(*Context)) *Task {
 	task := NewTask(name, project.contextArgm)
@@ -331,8 +626,7 @@ func (project *Project) Task(name string, dependencies Dependency, handler func(
 		task.dependencies = append(task.dependencies, dependencies)
 	}
 
-	project.Tasks[task.Name] = task
-	return task
+	return project.addTask(task)
 }
 
 // Task1 adds a simple task to the project.
@@ -345,8 +639,35 @@ func (project *Project) Task1(name string, handler func(*Context)) *Task {
 
 	task.Handler = HandlerFunc(handler)
 
-	project.Tasks[task.Name] = task
-	return task
+	return project.addTask(task)
+}
+
+// TaskE adds a task to the project with dependencies and a handler which
+// returns an error. A returned error fails the task.
+func (project *Project) TaskE(name string, dependencies Dependency, handler func(*Context) error) *Task {
+	task := NewTask(name, project.contextArgm)
+
+	if handler == nil && dependencies == nil {
+		util.Panic("godo", "Task %s requires a dependency or handler\n", name)
+	}
+
+	if handler != nil {
+		task.Handler = ErrorHandlerFunc(handler)
+	}
+	if dependencies != nil {
+		task.dependencies = append(task.dependencies, dependencies)
+	}
+
+	return project.addTask(task)
+}
+
+// Task1E adds a simple task to the project with a handler which returns an
+// error.
+func (project *Project) Task1E(name string, handler func(*Context) error) *Task {
+	if handler == nil {
+		util.Panic("godo", "Task %s requires a dependency or handler\n", name)
+	}
+	return project.TaskE(name, nil, handler)
 }
 
 // TaskD adds a task which runs other dependencies with no handler.
@@ -358,8 +679,7 @@ func (project *Project) TaskD(name string, dependencies Dependency) *Task {
 	}
 
 	task.dependencies = append(task.dependencies, dependencies)
-	project.Tasks[task.Name] = task
-	return task
+	return project.addTask(task)
 }
 
 func (project *Project) watchTask(task *Task, root string, logName string, handler func(e *watcher.FileEvent)) {
@@ -487,18 +807,115 @@ func (project *Project) gatherWatchInfo(task *Task) (globs []string, regexps []*
 	return
 }
 
+// watchRunner runs the graph of a watched task one run at a time. A new run
+// cancels the in-flight one.
+type watchRunner struct {
+	project  *Project
+	taskname string
+
+	mu       sync.Mutex
+	inflight *invocation
+	// failed are the tasks which failed in the last run
+	failed []*Task
+}
+
+// watchRunner returns the runner of the graph of task name, creating it if
+// needed.
+func (project *Project) watchRunner(name string) *watchRunner {
+	project.Lock()
+	defer project.Unlock()
+	if project.watchRunners == nil {
+		project.watchRunners = map[string]*watchRunner{}
+	}
+	w := project.watchRunners[name]
+	if w == nil {
+		w = &watchRunner{project: project, taskname: name}
+		project.watchRunners[name] = w
+	}
+	return w
+}
+
+// handle runs the tasks of the graph which are invalidated by e.
+func (w *watchRunner) handle(e *watcher.FileEvent) {
+	if w.project.isPaused() {
+		return
+	}
+	inv := w.project.newWatchInvocation(w.taskname, e)
+	if len(inv.invalid) == 0 {
+		return
+	}
+	inv.resubmit = w.handle
+	w.project.tracer().watchEvent(e, w.taskname)
+	w.start(inv)
+}
+
+// start runs inv once the in-flight run, which it cancels, has stopped.
+func (w *watchRunner) start(inv *invocation) {
+	w.mu.Lock()
+	prev := w.inflight
+	w.inflight = inv
+	w.mu.Unlock()
+
+	go func() {
+		defer inv.finish()
+		// other events are handled while the previous run stops
+		if prev != nil {
+			prev.cancel()
+			<-prev.done
+		}
+		err := w.project.runRoot(w.taskname, inv)
+		inv.tracer.flush()
+		if err == errRunCancelled {
+			util.Info(w.taskname, "cancelled by newer change\n")
+			return
+		}
+
+		var failed []*Task
+		failures := inv.failures()
+		if err != nil {
+			w.project.recordFailure(err)
+			util.Error("ERR", "%s\n", err.Error())
+			for task := range failures {
+				failed = append(failed, task)
+			}
+			if len(failed) == 0 {
+				// a hook failed
+				_, task, _ := w.project.mustTask(w.taskname)
+				failed = append(failed, task)
+				failures = map[*Task]error{task: err}
+			}
+			sort.Slice(failed, func(i, j int) bool {
+				return failed[i].qualifiedName() < failed[j].qualifiedName()
+			})
+		}
+
+		w.mu.Lock()
+		recovered := w.failed
+		w.failed = failed
+		w.mu.Unlock()
+		for _, task := range failed {
+			task.project.notify(&Notification{Task: task.qualifiedName(), Status: StatusFailed, Err: failures[task], Time: time.Now()})
+		}
+		if err == nil {
+			for _, task := range recovered {
+				task.project.notify(&Notification{Task: task.qualifiedName(), Status: StatusRecovered, Time: time.Now()})
+			}
+		}
+	}()
+}
+
 // Watch watches the Files of a task and reruns the task on a watch event. Any
 // direct dependency is also watched. Returns true if watching.
 //
+// Only the parent task watches, but it gathers watch info from all dependencies.
+// A change reruns only the tasks it invalidates and everything downstream of
+// them, in dependency order.
 //
-// TODO:
-// 1. Only the parent task watches, but it gathers wath info from all dependencies.
-//
-// 2. Anything without src files always run when a dependency is triggered by a glob match.
+// 1. Anything without src files always run when a dependency is triggered by a glob match.
 //
 //		build [generate{*.go} compile] => go file changes =>  build, generate and compile
 //
-// 3. Tasks with src only run if it matches a src
+// 2. Tasks with src only run if it matches a src
 //
 //       build [generate{*.go} css{*.scss} compile] => go file changes => build, generate and compile
 //       css does not need to run since no SCSS files ran
@@ -506,6 +923,8 @@ func (project *Project) gatherWatchInfo(task *Task) (globs []string, regexps []*
 // X depends on [A:txt, B]	=> txt changes	A runs, X runs without deps
 // X:txt on [A, B]			=> txt changes	A, B, X runs
 //
+// A change which arrives while the graph is still running cancels the
+// in-flight run before the new one starts.
 func (project *Project) Watch(names []string, isParent bool) bool {
 	// fixes a bug where the first debounce prevents the task from running because
 	// all tasks are run once before Watch() is called
@@ -515,23 +934,28 @@ func (project *Project) Watch(names []string, isParent bool) bool {
 
 	taskClosure := func(project *Project, task *Task, taskname string, logName string) func() {
 		paths := calculateWatchPaths(task.EffectiveWatchGlobs)
+		handler := project.watchRunner(taskname).handle
+
 		return func() {
 			if len(paths) == 0 {
 				return
 			}
 			for _, pth := range paths {
 				go func(path string) {
-					project.watchTask(task, path, logName, func(e *watcher.FileEvent) {
-						err := project.run(taskname, taskname, e)
-						if err != nil {
-							util.Error("ERR", "%s\n", err.Error())
-						}
-					})
+					project.watchTask(task, path, logName, handler)
 				}(pth)
 			}
 		}
 	}
 
+	_, tasks := project.allTasks()
+	for _, task := range tasks {
+		if task.liveReload {
+			startLiveReload()
+			break
+		}
+	}
+
 	for _, taskname := range names {
 		proj, task, _ := project.mustTask(taskname)
 		// updates effectiveWatchGlobs
@@ -548,6 +972,40 @@ func (project *Project) Watch(names []string, isParent bool) bool {
 	return false
 }
 
+// togglePause pauses or resumes watching. Returns true if paused.
+func (project *Project) togglePause() bool {
+	project.Lock()
+	defer project.Unlock()
+	project.paused = !project.paused
+	return project.paused
+}
+
+func (project *Project) isPaused() bool {
+	project.Lock()
+	defer project.Unlock()
+	return project.paused
+}
+
+// recordFailure remembers err as the last failure, with the STDERR of the
+// command which failed.
+func (project *Project) recordFailure(err error) {
+	failure := fmt.Sprintf("%s %s", time.Now().Format("15:04:05"), err.Error())
+	var execErr *ExecError
+	if errors.As(err, &execErr) && execErr.Stderr != "" {
+		failure += "\n" + execErr.Stderr
+	}
+	project.Lock()
+	project.failure = failure
+	project.Unlock()
+}
+
+// lastFailure returns the last failure or "" if none.
+func (project *Project) lastFailure() string {
+	project.Lock()
+	defer project.Unlock()
+	return project.failure
+}
+
 // Dumps information about the project to the console
 func (project *Project) dump(buf io.Writer, prefix string, indent string) {
 	fmt.Fprintln(buf, "")
@@ -586,8 +1044,15 @@ func (project *Project) quit(isParent bool) {
 	//fmt.Printf("DBG: QUITTED\n")
 }
 
-// Exit quits the project.
+// Exit quits the project. When watching, godo exits with code.
 func (project *Project) Exit(code int) {
+	root := project
+	for root.parent != nil {
+		root = root.parent
+	}
+	root.Lock()
+	root.exitCode = code
+	root.Unlock()
 	project.quit(true)
 }
 
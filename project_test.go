@@ -1,6 +1,7 @@
 package godo
 
 import (
+	"errors"
 	"sort"
 	"testing"
 	"time"
@@ -64,9 +65,10 @@ func TestTaskArgs(t *testing.T) {
 
 	execCLI(tasks, []string{"foo", "--", "--name=gopher"}, nil)
 	assert.Equal("gopher", result)
-	assert.Panics(func() {
-		runTask(tasks, "foo")
-	})
+	// a panic fails the task
+	_, err := runTask(tasks, "foo")
+	var panicErr *PanicError
+	assert.True(errors.As(err, &panicErr))
 }
 
 func TestDependency(t *testing.T) {
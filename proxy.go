@@ -0,0 +1,159 @@
+package godo
+
+import (
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+
+	"gopkg.in/godo.v2/util"
+)
+
+// DefaultProxyTimeout is the maximum time a DevProxy holds a request while
+// waiting for its backend.
+var DefaultProxyTimeout = 30 * time.Second
+
+const buildErrorPage = `<!DOCTYPE html>
+<html>
+<head><title>Build failed</title></head>
+<body style="font-family: monospace">
+<h2>%s failed</h2>
+<pre style="color: #c00">%s</pre>
+</body>
+</html>
+`
+
+// DevProxy is a reverse proxy which fronts a server started with Start.
+// Requests are held while the server is rebuilding or not yet listening,
+// and the build error is shown when the last rebuild failed.
+type DevProxy struct {
+	// Addr is the address the proxy listens on, eg ":3000".
+	Addr string
+	// Backend is the address of the server, eg "localhost:8080".
+	Backend string
+	// Timeout is the maximum time to hold a request.
+	Timeout time.Duration
+
+	mu       sync.Mutex
+	ready    chan struct{}
+	task     string
+	buildErr error
+	proxy    *httputil.ReverseProxy
+	once     sync.Once
+}
+
+// NewDevProxy creates a proxy listening on addr which forwards to backend.
+func NewDevProxy(addr string, backend string) *DevProxy {
+	ready := make(chan struct{})
+	close(ready)
+	dp := &DevProxy{
+		Addr:    addr,
+		Backend: backend,
+		Timeout: DefaultProxyTimeout,
+		ready:   ready,
+	}
+	dp.proxy = httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: backend})
+	dp.proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	}
+	return dp
+}
+
+// start starts listening once.
+func (dp *DevProxy) start() {
+	dp.once.Do(func() {
+		util.Info("proxy", "%s -> %s\n", dp.Addr, dp.Backend)
+		go func() {
+			err := http.ListenAndServe(dp.Addr, dp)
+			if err != nil {
+				util.Error("proxy", "%s\n", err.Error())
+			}
+		}()
+	})
+}
+
+// beginBuild holds new requests until endBuild is called.
+func (dp *DevProxy) beginBuild(task string) {
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+	select {
+	case <-dp.ready:
+		dp.ready = make(chan struct{})
+	default:
+	}
+	dp.task = task
+}
+
+// endBuild releases held requests. If err is not nil, requests are answered
+// with the error until the next successful build.
+func (dp *DevProxy) endBuild(err error) {
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+	dp.buildErr = err
+	select {
+	case <-dp.ready:
+	default:
+		close(dp.ready)
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (dp *DevProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	timeout := time.After(dp.Timeout)
+
+	dp.mu.Lock()
+	ready := dp.ready
+	dp.mu.Unlock()
+
+	select {
+	case <-ready:
+	case <-timeout:
+		http.Error(w, "timed out waiting for build", http.StatusGatewayTimeout)
+		return
+	case <-r.Context().Done():
+		return
+	}
+
+	dp.mu.Lock()
+	task, buildErr := dp.task, dp.buildErr
+	dp.mu.Unlock()
+	if buildErr != nil {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, buildErrorPage, html.EscapeString(task), html.EscapeString(Mask(buildErr.Error())))
+		return
+	}
+
+	// the server may still be starting after the build
+	if !dp.waitBackend(timeout, r.Context().Done()) {
+		if r.Context().Err() == nil {
+			http.Error(w, "timed out waiting for "+dp.Backend, http.StatusGatewayTimeout)
+		}
+		return
+	}
+
+	dp.proxy.ServeHTTP(w, r)
+}
+
+// waitBackend waits until the backend accepts connections. It returns false
+// if timeout or done fires first.
+func (dp *DevProxy) waitBackend(timeout <-chan time.Time, done <-chan struct{}) bool {
+	for {
+		conn, err := net.DialTimeout("tcp", dp.Backend, time.Second)
+		if err == nil {
+			conn.Close()
+			return true
+		}
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-timeout:
+			return false
+		case <-done:
+			return false
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package godo
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestDevProxyHoldsDuringBuild(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	dp := NewDevProxy("", strings.TrimPrefix(backend.URL, "http://"))
+	proxy := httptest.NewServer(dp)
+	defer proxy.Close()
+
+	dp.beginBuild("server")
+	released := time.Now().Add(200 * time.Millisecond)
+	time.AfterFunc(200*time.Millisecond, func() {
+		dp.endBuild(nil)
+	})
+
+	res, err := http.Get(proxy.URL)
+	assert.NoError(t, err)
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, "ok", string(body))
+	assert.False(t, time.Now().Before(released), "request should have been held")
+}
+
+func TestDevProxyWaitBackend(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	assert.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	dp := NewDevProxy("", addr)
+	assert.False(t, dp.waitBackend(time.After(200*time.Millisecond), nil))
+
+	listening := make(chan net.Listener, 1)
+	time.AfterFunc(200*time.Millisecond, func() {
+		listener, err := net.Listen("tcp", addr)
+		assert.NoError(t, err)
+		listening <- listener
+	})
+	assert.True(t, dp.waitBackend(time.After(5*time.Second), nil))
+	if listener := <-listening; listener != nil {
+		listener.Close()
+	}
+}
+
+func TestDevProxyBuildError(t *testing.T) {
+	defer resetSecrets()
+	dp := NewDevProxy("", "localhost:1")
+	proxy := httptest.NewServer(dp)
+	defer proxy.Close()
+
+	dp.beginBuild("server")
+	dp.endBuild(errors.New("undefined: <foo> token=" + Secret("abc123")))
+
+	res, err := http.Get(proxy.URL)
+	assert.NoError(t, err)
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, 500, res.StatusCode)
+	assert.Contains(t, string(body), "undefined: &lt;foo&gt; token=***")
+	assert.NotContains(t, string(body), "abc123")
+}
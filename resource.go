@@ -0,0 +1,137 @@
+package godo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// resources are the semaphores of the resources used by the tasks of a root
+// project and its namespaces.
+type resources struct {
+	sync.Mutex
+	m map[string]*resource
+}
+
+// resource is a semaphore with the capacity tasks declared for it. err is
+// set if tasks declared different capacities.
+type resource struct {
+	sem chan struct{}
+	err error
+}
+
+// resource returns the semaphore of resource name, which task declared with
+// capacity. It fails if tasks of the project declare name with different
+// capacities, since only one of them could be honoured.
+func (project *Project) resource(name string, capacity int, task *Task) (chan struct{}, error) {
+	root := project
+	for root.parent != nil {
+		root = root.parent
+	}
+	root.resources.Lock()
+	defer root.resources.Unlock()
+	r := root.resources.m[name]
+	if r == nil {
+		r = &resource{sem: make(chan struct{}, capacity)}
+		users := map[int][]string{}
+		root.resourceUsers(name, users, map[*Project]bool{})
+		if len(users) > 1 {
+			r.err = resourceMismatch(name, users)
+		}
+		root.resources.m[name] = r
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if cap(r.sem) != capacity {
+		// a task added while running, e.g. by LazyDeps
+		users := map[int][]string{capacity: {task.Name}}
+		root.resourceUsers(name, users, map[*Project]bool{})
+		return nil, resourceMismatch(name, users)
+	}
+	return r.sem, nil
+}
+
+// resourceUsers collects the names of the tasks of project and its
+// namespaces which use resource name by capacity.
+func (project *Project) resourceUsers(name string, users map[int][]string, visited map[*Project]bool) {
+	if visited[project] {
+		return
+	}
+	visited[project] = true
+	project.Lock()
+	tasks := make([]*Task, 0, len(project.Tasks))
+	for _, task := range project.Tasks {
+		tasks = append(tasks, task)
+	}
+	namespaces := make([]*Project, 0, len(project.Namespace))
+	for _, proj := range project.Namespace {
+		namespaces = append(namespaces, proj)
+	}
+	project.Unlock()
+
+	for _, task := range tasks {
+		if n, ok := task.resources[name]; ok {
+			users[n] = append(users[n], task.key())
+		}
+	}
+	for _, proj := range namespaces {
+		proj.resourceUsers(name, users, visited)
+	}
+}
+
+// resourceMismatch is the error of resource name declared with different
+// capacities by users.
+func resourceMismatch(name string, users map[int][]string) error {
+	capacities := make([]int, 0, len(users))
+	for n := range users {
+		capacities = append(capacities, n)
+	}
+	sort.Ints(capacities)
+	declared := make([]string, len(capacities))
+	for i, n := range capacities {
+		names := users[n]
+		sort.Strings(names)
+		declared[i] = fmt.Sprintf("%d by %s", n, strings.Join(names, ", "))
+	}
+	return fmt.Errorf("resource %q is declared with different capacities: %s", name, strings.Join(declared, "; "))
+}
+
+// acquire waits for the resources of task. Resources are acquired in order
+// of their names so tasks sharing several resources cannot deadlock. The
+// returned func releases them.
+func (project *Project) acquire(task *Task, inv *invocation) (release func(), err error) {
+	names := make([]string, 0, len(task.resources))
+	for name := range task.resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var held []chan struct{}
+	release = func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			<-held[i]
+		}
+	}
+	for _, name := range names {
+		sem, err := project.resource(name, task.resources[name], task)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		select {
+		case sem <- struct{}{}:
+		default:
+			logVerbose(task.Name, "waiting for %s\n", name)
+			select {
+			case sem <- struct{}{}:
+			case <-inv.cancelled:
+				release()
+				return nil, errRunCancelled
+			}
+		}
+		held = append(held, sem)
+	}
+	return release, nil
+}
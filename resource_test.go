@@ -0,0 +1,130 @@
+package godo
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+// concurrency records the most handlers which ran at the same time.
+type concurrency struct {
+	sync.Mutex
+	running map[string]int
+	max     map[string]int
+}
+
+func newConcurrency() *concurrency {
+	return &concurrency{running: map[string]int{}, max: map[string]int{}}
+}
+
+func (cc *concurrency) handler(groups ...string) func(*Context) {
+	return func(*Context) {
+		cc.Lock()
+		for _, group := range groups {
+			cc.running[group]++
+			if cc.running[group] > cc.max[group] {
+				cc.max[group] = cc.running[group]
+			}
+		}
+		cc.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		cc.Lock()
+		for _, group := range groups {
+			cc.running[group]--
+		}
+		cc.Unlock()
+	}
+}
+
+func TestExclusive(t *testing.T) {
+	cc := newConcurrency()
+	tasks := func(p *Project) {
+		p.Task1("a", cc.handler("all", "db")).Exclusive("test-db")
+		p.Task1("b", cc.handler("all", "db")).Exclusive("test-db")
+		p.Task1("c", cc.handler("all"))
+		p.Task("default", P{"a", "b", "c"}, nil)
+	}
+	_, err := runTask(tasks, "default")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cc.max["db"])
+	assert.Equal(t, 2, cc.max["all"])
+}
+
+func TestResources(t *testing.T) {
+	cc := newConcurrency()
+	tasks := func(p *Project) {
+		p.Task1("a", cc.handler("port")).Resources("test-port", 2)
+		p.Task1("b", cc.handler("port")).Resources("test-port", 2)
+		p.Task1("c", cc.handler("port")).Resources("test-port", 2)
+		p.Task("default", P{"a", "b", "c"}, nil)
+	}
+	_, err := runTask(tasks, "default")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, cc.max["port"])
+}
+
+func TestExclusiveOrder(t *testing.T) {
+	cc := newConcurrency()
+	tasks := func(p *Project) {
+		p.Task1("a", cc.handler("x")).Exclusive("test-x", "test-y")
+		p.Task1("b", cc.handler("x")).Exclusive("test-y", "test-x")
+		p.Task1("c", cc.handler("x")).Exclusive("test-x", "test-y")
+		p.Task("default", P{"a", "b", "c"}, nil)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := runTask(tasks, "default")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadlocked")
+	}
+	assert.Equal(t, 1, cc.max["x"])
+}
+
+func TestExclusiveCancelled(t *testing.T) {
+	var task *Task
+	proj := NewProject(func(p *Project) {
+		task = p.Task1("a", func(*Context) {}).Exclusive("test-cancel")
+	}, func(int) {}, nil)
+	// another task holds the lock
+	sem, err := proj.resource("test-cancel", 1, task)
+	assert.NoError(t, err)
+	sem <- struct{}{}
+	defer func() {
+		<-sem
+	}()
+
+	inv := newInvocation(nil)
+	inv.cancel()
+	_, err = proj.acquire(task, inv)
+	assert.Equal(t, errRunCancelled, err)
+}
+
+func TestResourcesMismatch(t *testing.T) {
+	ran := false
+	tasks := func(p *Project) {
+		p.Task1("a", func(*Context) { ran = true }).Resources("test-mismatch", 2)
+		p.Use("db", func(p *Project) {
+			p.Task1("b", func(*Context) { ran = true }).Resources("test-mismatch", 1)
+		})
+		p.Task1("c", func(*Context) { ran = true }).Resources("test-mismatch", 2)
+	}
+	_, err := runTask(tasks, "a")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `resource "test-mismatch" is declared with different capacities: 1 by root:db:b; 2 by root:a, root:c`)
+	}
+	assert.False(t, ran)
+
+	// projects do not share resources
+	_, err = runTask(func(p *Project) {
+		p.Task1("a", func(*Context) {}).Resources("test-mismatch", 3)
+	}, "a")
+	assert.NoError(t, err)
+}
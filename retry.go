@@ -0,0 +1,155 @@
+package godo
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/godo.v2/util"
+)
+
+// retryPolicy retries a failed command or task.
+type retryPolicy struct {
+	// retries is the number of retries after the first attempt
+	retries int
+	// backoff is the delay before the first retry. It doubles after each
+	// retry.
+	backoff time.Duration
+	// exitCodes limits retries to these exit codes if not empty
+	exitCodes []int
+	// patterns limits retries to output matching any pattern if not empty
+	patterns []*regexp.Regexp
+	// err is the error of the first pattern which does not compile. It
+	// fails each run instead of an attempt.
+	err error
+}
+
+// RetryError is the error of a command or task which failed every attempt.
+type RetryError struct {
+	// Errors are the errors of each attempt.
+	Errors []error
+}
+
+func (e *RetryError) Error() string {
+	lines := []string{fmt.Sprintf("failed after %d attempts", len(e.Errors))}
+	for i, err := range e.Errors {
+		lines = append(lines, fmt.Sprintf("attempt %d: %s", i+1, err.Error()))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Is determines if the error of any attempt is target, so errors.Is looks
+// through a RetryError.
+func (e *RetryError) Is(target error) bool {
+	return anyIs(e.Errors, target)
+}
+
+// As finds the first error of the attempts which matches target, so
+// errors.As looks through a RetryError.
+func (e *RetryError) As(target interface{}) bool {
+	return anyAs(e.Errors, target)
+}
+
+func (rp *retryPolicy) setRetry(n int, backoff time.Duration) {
+	if n < 0 {
+		n = 0
+	}
+	rp.retries = n
+	rp.backoff = backoff
+}
+
+func (rp *retryPolicy) onExit(codes []int) {
+	rp.exitCodes = append(rp.exitCodes, codes...)
+}
+
+func (rp *retryPolicy) onOutput(patterns []string) {
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			if rp.err == nil {
+				rp.err = fmt.Errorf("invalid retry pattern %q: %s", pattern, err.Error())
+			}
+			continue
+		}
+		rp.patterns = append(rp.patterns, re)
+	}
+}
+
+// captures determines if output must be captured to apply the policy.
+func (rp *retryPolicy) captures() bool {
+	return rp != nil && rp.retries > 0 && len(rp.patterns) > 0
+}
+
+// matches determines if a failed attempt may be retried. result is the
+// result of the failed command and may be nil.
+func (rp *retryPolicy) matches(err error, result *Result) bool {
+	if len(rp.exitCodes) > 0 {
+		if result == nil {
+			return false
+		}
+		found := false
+		for _, code := range rp.exitCodes {
+			found = found || code == result.ExitCode
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(rp.patterns) > 0 {
+		text := err.Error()
+		if result != nil {
+			text = result.Output + "\n" + result.Stdout + "\n" + result.Stderr + "\n" + text
+		}
+		for _, re := range rp.patterns {
+			if re.MatchString(text) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// do runs attempt until it succeeds, the policy gives up or cancelled is
+// closed. The error of a single attempt is returned as is, otherwise a
+// RetryError has the errors of all attempts.
+func (rp *retryPolicy) do(name string, cancelled <-chan struct{}, attempt func() (*Result, error)) error {
+	if rp != nil && rp.err != nil {
+		return rp.err
+	}
+	if rp == nil || rp.retries == 0 {
+		_, err := attempt()
+		return err
+	}
+
+	var errs []error
+	delay := rp.backoff
+	for n := 1; ; n++ {
+		if n > 1 {
+			util.Info(name, "attempt %d of %d\n", n, rp.retries+1)
+		}
+		result, err := attempt()
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+		if err == errRunCancelled || n > rp.retries || !rp.matches(err, result) {
+			break
+		}
+		util.Error(name, "attempt %d of %d failed, retrying in %s\n%s\n", n, rp.retries+1, delay, Mask(err.Error()))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-cancelled:
+			timer.Stop()
+			return errRunCancelled
+		}
+		delay *= 2
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return &RetryError{Errors: errs}
+}
@@ -0,0 +1,129 @@
+package godo
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+// flakyScript fails until it has run n times, counting runs in a file.
+func flakyScript(t *testing.T, n int) string {
+	dir, err := ioutil.TempDir("", "godo-retry")
+	assert.NoError(t, err)
+	count := filepath.Join(dir, "count")
+	return fmt.Sprintf(`echo -n x >> %s; [ $(wc -c < %s) -ge %d ] || { echo -n busy; exit 9; }`, Quote(count), Quote(count), n)
+}
+
+func TestCommandRetry(t *testing.T) {
+	if isWindows {
+		return
+	}
+	_, err := BashCommand(flakyScript(t, 3)).Stdout(ioutil.Discard).Retry(2, time.Millisecond).Run(nil)
+	assert.NoError(t, err)
+
+	_, err = BashCommand(flakyScript(t, 4)).Stdout(ioutil.Discard).Retry(2, time.Millisecond).Run(nil)
+	var retryErr *RetryError
+	assert.True(t, errors.As(err, &retryErr))
+	assert.Equal(t, 3, len(retryErr.Errors))
+	assert.Contains(t, err.Error(), "attempt 3: `echo")
+
+	// filters
+	_, err = BashCommand(flakyScript(t, 2)).Stdout(ioutil.Discard).Retry(2, time.Millisecond).RetryOnExit(1).Run(nil)
+	assert.True(t, strings.HasSuffix(err.Error(), "`: exit status 9"))
+	_, err = BashCommand(flakyScript(t, 2)).Stdout(ioutil.Discard).Retry(2, time.Millisecond).RetryOnExit(9).Run(nil)
+	assert.NoError(t, err)
+	_, err = BashCommand(flakyScript(t, 2)).Stdout(ioutil.Discard).Retry(2, time.Millisecond).RetryOnOutput("timeout").Run(nil)
+	assert.True(t, strings.HasSuffix(err.Error(), "`: exit status 9"))
+	_, err = BashCommand(flakyScript(t, 2)).Stdout(ioutil.Discard).Retry(2, time.Millisecond).RetryOnOutput("bu+sy").Run(nil)
+	assert.NoError(t, err)
+}
+
+func TestTaskRetry(t *testing.T) {
+	attempts := 0
+	tasks := func(p *Project) {
+		p.Task1("flaky", func(c *Context) {
+			attempts++
+			if attempts < 3 {
+				c.Error = errors.New("flaky")
+			}
+		}).Retry(2, time.Millisecond)
+	}
+	_, err := runTask(tasks, "flaky")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+
+	attempts = 0
+	tasks = func(p *Project) {
+		p.Task1("flaky", func(c *Context) {
+			attempts++
+			Halt(fmt.Sprintf("failed %d", attempts))
+		}).Retry(1, time.Millisecond)
+	}
+	_, err = runTask(tasks, "flaky")
+	assert.Equal(t, 2, attempts)
+	assert.Contains(t, err.Error(), "attempt 1: failed 1")
+	assert.Contains(t, err.Error(), "attempt 2: failed 2")
+}
+
+func TestTaskRetryFilter(t *testing.T) {
+	if isWindows {
+		return
+	}
+	script := flakyScript(t, 2)
+	tasks := func(p *Project) {
+		p.Task1("flaky", func(c *Context) {
+			c.Bash(script)
+		}).Retry(1, time.Millisecond).RetryOnExit(2)
+	}
+	_, err := runTask(tasks, "flaky")
+	assert.Contains(t, err.Error(), "exit status 9")
+
+	script = flakyScript(t, 2)
+	tasks = func(p *Project) {
+		p.Task1("flaky", func(c *Context) {
+			c.Bash(script)
+		}).Retry(1, time.Millisecond).RetryOnOutput("busy")
+	}
+	_, err = runTask(tasks, "flaky")
+	assert.NoError(t, err)
+}
+
+func TestRetryCancelled(t *testing.T) {
+	rp := &retryPolicy{}
+	rp.setRetry(5, time.Hour)
+	cancelled := make(chan struct{})
+	attempts := 0
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(cancelled)
+	}()
+	err := rp.do("test", cancelled, func() (*Result, error) {
+		attempts++
+		return nil, errors.New("failed")
+	})
+	assert.Equal(t, errRunCancelled, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRetryInvalidPattern(t *testing.T) {
+	_, err := Command("true").Retry(1, time.Millisecond).RetryOnOutput("busy", "(").Run(nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid retry pattern "("`)
+
+	ran := false
+	tasks := func(p *Project) {
+		p.Task1("flaky", func(c *Context) {
+			ran = true
+		}).Retry(1, time.Millisecond).RetryOnOutput("[")
+	}
+	_, err = runTask(tasks, "flaky")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid retry pattern "["`)
+	assert.False(t, ran)
+}
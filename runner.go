@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
 	"time"
 
@@ -27,6 +26,15 @@ var verbose bool
 var version bool
 var deprecatedWarnings bool
 
+// keepGoing runs independent tasks after a task fails
+var keepGoing bool
+
+// dryRun logs the tasks which would run without running them
+var dryRun bool
+
+// showTimings prints where the time went after each run
+var showTimings bool
+
 // DebounceMs is the default time (1500 ms) to debounce task events in watch mode.
 var Debounce time.Duration
 var runnerWaitGroup = &WaitGroupN{}
@@ -71,10 +79,19 @@ Usage: godo [flags] [task...]
       --dump     Dump debug info about the project
   -h, --help     This screen
   -i, --install  Install Godofile dependencies
+  -k, --keep-going
+                 Run independent tasks after a task fails and report
+                 every failure at the end
+  -n, --dry-run  Print the tasks which would run without running them
+      --profile  Select a profile, e.g. --profile=prod
       --rebuild  Rebuild Godofile
+      --timings  Print the critical path, task times and idle time after
+                 each run
+      --trace    Write a Chrome trace of the runs, e.g. --trace=trace.json
   -v  --verbose  Log verbosely
   -V, --version  Print version
-  -w, --watch    Watch task and dependencies`
+  -w, --watch    Watch task and dependencies. Press h while watching
+                 for console commands`
 
 	if tasks == "" {
 		fmt.Printf(format, Version)
@@ -84,6 +101,51 @@ Usage: godo [flags] [task...]
 	}
 }
 
+// runInterruptible runs task name. An interrupt cancels the run, killing
+// running commands, so Finally and After tasks run before godo exits. A
+// second interrupt exits right away.
+func (project *Project) runInterruptible(name string) error {
+	inv := newInvocation(nil)
+	csig := make(chan os.Signal, 2)
+	signal.Notify(csig, os.Interrupt)
+	defer signal.Stop(csig)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-csig:
+		case <-done:
+			return
+		}
+		util.Error("godo", "interrupted, running cleanup tasks. Interrupt again to quit\n")
+		inv.cancel()
+		select {
+		case <-csig:
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+	err := project.runRoot(name, inv)
+	if showTimings && !dryRun {
+		inv.printTimings(os.Stdout)
+	}
+	return err
+}
+
+// reportFailures logs each task failure of err.
+func reportFailures(err error) {
+	multi, ok := err.(*MultiError)
+	if !ok {
+		util.Error("ERR", "%s\n", err.Error())
+		return
+	}
+	util.Error("ERR", "%d tasks failed\n", len(multi.Errors))
+	for _, err := range multi.Errors {
+		util.Error("ERR", "%s\n", err.Error())
+	}
+}
+
 // Godo runs a project of tasks.
 func Godo(tasksFunc func(*Project)) {
 	godo(tasksFunc, nil)
@@ -107,9 +169,17 @@ func godoExit(tasksFunc func(*Project), argv []string, exitFn func(int)) {
 	version = argm.AsBool("version", "V")
 	watching = argm.AsBool("watch", "w")
 	deprecatedWarnings = argm.AsBool("D")
+	keepGoing = argm.AsBool("k", "keep-going")
+	dryRun = argm.AsBool("n", "dry-run")
+	showTimings = argm.AsBool("timings")
+	tracePath := argm.AsString("trace")
+	profile := argm.AsString("profile")
 	contextArgm := minimist.ParseArgv(argm.Unparsed())
 
 	project := NewProject(tasksFunc, exitFn, contextArgm)
+	if tracePath != "" {
+		project.trace = newTracer(tracePath)
+	}
 
 	if help {
 		Usage(project.usage())
@@ -126,14 +196,24 @@ func godoExit(tasksFunc func(*Project), argv []string, exitFn func(int)) {
 		exitFn(0)
 	}
 
+	if err := project.useProfile(profile); err != nil {
+		util.Error("ERR", "%s\n", err.Error())
+		exitFn(1)
+	}
+
+	if err := LoadDotenv(profile); err != nil {
+		util.Error("ERR", "%s\n", err.Error())
+		exitFn(1)
+	}
+
 	// env vars are any nonflag key=value pair
-	addToOSEnviron(argm.NonFlags())
+	setCLIEnv(argm.NonFlags())
 
 	// Run each task including their dependencies.
 	args := []string{}
 	for _, s := range argm.NonFlags() {
 		// skip env vars
-		if !strings.Contains(s, "=") {
+		if !isEnvArg(s) {
 			args = append(args, s)
 		}
 	}
@@ -147,18 +227,44 @@ func godoExit(tasksFunc func(*Project), argv []string, exitFn func(int)) {
 		}
 	}
 
+	if err := timings.load(TimingsFile); err != nil {
+		logVerbose("godo", "%s\n", err.Error())
+	}
+	saveTimings := func() {
+		if dryRun {
+			return
+		}
+		if err := timings.save(TimingsFile); err != nil {
+			logVerbose("godo", "%s\n", err.Error())
+		}
+	}
+
+	var failures []error
 	for _, name := range args {
-		err := project.Run(name)
-		if err != nil {
+		err := project.runInterruptible(name)
+		saveTimings()
+		project.trace.flush()
+		if err == errRunCancelled {
+			util.Error("ERR", "interrupted\n")
+			exitFn(130)
+		}
+		if err != nil && !keepGoing {
 			util.Error("ERR", "%s\n", err.Error())
 			exitFn(1)
 		}
+		failures = append(failures, err)
+	}
+	if err := joinFailures(failures...); err != nil {
+		reportFailures(err)
+		exitFn(1)
 	}
 
+	var con *console
 	if watching {
 		if project.Watch(args, true) {
 			runnerWaitGroup.Add(1)
 			waitExit = true
+			con = project.startConsole(args)
 		} else {
 			fmt.Println("Nothing to watch. Use Task#Src() to specify watch patterns")
 			exitFn(0)
@@ -182,7 +288,13 @@ func godoExit(tasksFunc func(*Project), argv []string, exitFn func(int)) {
 
 		runnerWaitGroup.Wait()
 	}
-	exitFn(0)
+	if con != nil {
+		con.close()
+	}
+	project.Lock()
+	code := project.exitCode
+	project.Unlock()
+	exitFn(code)
 }
 
 // MustNotError checks if error is not nil. If it is not nil it will panic.
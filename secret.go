@@ -0,0 +1,96 @@
+package godo
+
+import (
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// secretMask replaces secrets in logs and captured output
+const secretMask = "***"
+
+// secrets are the registered secret values, longest first so a secret which
+// contains another is masked entirely.
+var secrets = struct {
+	sync.RWMutex
+	values []string
+}{}
+
+// Secret registers value as a secret and returns it. Secrets are passed to
+// commands unchanged but are masked as *** wherever godo logs or records
+// output.
+//
+//		token := do.Secret(os.Getenv("GITHUB_TOKEN"))
+//		c.Run("git push https://{{.token}}@github.com/acme/app", do.M{"token": token})
+func Secret(value string) string {
+	if value == "" {
+		return value
+	}
+	secrets.Lock()
+	defer secrets.Unlock()
+	for _, v := range secrets.values {
+		if v == value {
+			return value
+		}
+	}
+	secrets.values = append(secrets.values, value)
+	sort.SliceStable(secrets.values, func(i, j int) bool {
+		return len(secrets.values[i]) > len(secrets.values[j])
+	})
+	return value
+}
+
+// SecretEnv gets an environment variable as seen by commands and registers
+// its value as a secret.
+func SecretEnv(key string) string {
+	return Secret(Getenv(key))
+}
+
+// SecretFile reads a secret from a file. Trailing newlines are removed.
+func SecretFile(filename string) (string, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	return Secret(strings.TrimRight(string(b), "\r\n")), nil
+}
+
+// Mask replaces all secrets in s with ***.
+func Mask(s string) string {
+	secrets.RLock()
+	defer secrets.RUnlock()
+	for _, v := range secrets.values {
+		s = strings.Replace(s, v, secretMask, -1)
+	}
+	return s
+}
+
+func hasSecrets() bool {
+	secrets.RLock()
+	defer secrets.RUnlock()
+	return len(secrets.values) > 0
+}
+
+// secretPrefixIndex returns the index of the longest end of s which is the
+// start of a secret, len(s) if there is none.
+func secretPrefixIndex(s string) int {
+	secrets.RLock()
+	defer secrets.RUnlock()
+	if len(secrets.values) == 0 {
+		return len(s)
+	}
+	// the first secret is the longest
+	start := len(s) - len(secrets.values[0]) + 1
+	if start < 0 {
+		start = 0
+	}
+	for i := start; i < len(s); i++ {
+		for _, v := range secrets.values {
+			if len(s)-i < len(v) && strings.HasPrefix(v, s[i:]) {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
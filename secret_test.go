@@ -0,0 +1,105 @@
+package godo
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func resetSecrets() {
+	secrets.Lock()
+	secrets.values = nil
+	secrets.Unlock()
+}
+
+func TestMask(t *testing.T) {
+	defer resetSecrets()
+	assert.Equal(t, "s3cret", Secret("s3cret"))
+	Secret("s3cret-long")
+	assert.Equal(t, "token=*** and ***", Mask("token=s3cret and s3cret-long"))
+
+	dir, _ := ioutil.TempDir("", "godo-secret")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "token")
+	ioutil.WriteFile(filename, []byte("from-file\n"), 0600)
+	s, err := SecretFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, "from-file", s)
+	assert.Equal(t, "***", Mask("from-file"))
+}
+
+func TestMaskCapturedOutput(t *testing.T) {
+	if isWindows {
+		return
+	}
+	defer resetSecrets()
+	defer setCLIEnv(nil)
+	setCLIEnv([]string{"SECRET_TOKEN=abc123"})
+	assert.Equal(t, "abc123", SecretEnv("SECRET_TOKEN"))
+
+	output, err := BashOutput("echo -n token=$SECRET_TOKEN")
+	assert.NoError(t, err)
+	assert.Equal(t, "token=***", output)
+}
+
+func TestMaskDebugEnv(t *testing.T) {
+	if isWindows {
+		return
+	}
+	defer resetSecrets()
+	oldVerbose := verbose
+	verbose = true
+	defer func() {
+		verbose = oldVerbose
+	}()
+
+	context := &Context{}
+	context.Setenv("DEBUG_TOKEN", Secret("abc123"))
+	log := captureLog(func() {
+		Command("true").Run(context)
+	})
+	assert.Contains(t, log, "DEBUG_TOKEN=***")
+	assert.NotContains(t, log, "abc123")
+}
+
+func TestMaskExecError(t *testing.T) {
+	if isWindows {
+		return
+	}
+	defer resetSecrets()
+	Secret("abc123")
+
+	_, err := CommandArgv("sh", "-c", "exit 1", "token=abc123").Capture().Run(nil)
+	var execErr *ExecError
+	assert.True(t, errors.As(err, &execErr))
+	assert.Equal(t, []string{"sh", "-c", "exit 1", "token=***"}, execErr.Argv)
+	assert.NotContains(t, err.Error(), "abc123")
+}
+
+func TestMaskFileWrapper(t *testing.T) {
+	defer resetSecrets()
+	Secret("abc123")
+
+	f, _ := ioutil.TempFile("", "godo-secret")
+	defer os.Remove(f.Name())
+	var recorder bytes.Buffer
+	w := newFileWrapper(f, &recorder, "")
+	w.Write([]byte("password: "))
+	b, _ := ioutil.ReadFile(f.Name())
+	assert.Equal(t, "password: ", string(b), "partial line without a secret is not held")
+	w.Write([]byte("token=ab"))
+	b, _ = ioutil.ReadFile(f.Name())
+	assert.Equal(t, "password: token=", string(b), "start of a secret is held")
+	w.Write([]byte("c123\nnext "))
+	w.Write([]byte("abc123"))
+	w.flush()
+	f.Close()
+
+	b, _ = ioutil.ReadFile(f.Name())
+	assert.Equal(t, "password: token=***\nnext ***", string(b))
+}
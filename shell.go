@@ -0,0 +1,95 @@
+package godo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// EmbeddedShell runs Bash and BashOutput scripts with a shell interpreter
+// built into godo instead of the system bash, so Gododirs work where bash is
+// missing and behave the same with every bash version. Scripts which use
+// features the interpreter lacks still run with bash.
+//
+// The interpreter is not linked into godo by default. Import the shell
+// package for it to register itself:
+//
+//		import _ "gopkg.in/godo.v2/shell"
+var EmbeddedShell bool
+
+// Shell is a shell interpreter which runs bash scripts in the godo process.
+// See EmbeddedShell and RegisterShell.
+type Shell interface {
+	// Parse parses script. It returns an error if the script does not parse
+	// or uses features the interpreter lacks, in which case it runs with
+	// bash.
+	Parse(script string) (ShellScript, error)
+}
+
+// ShellScript is a script parsed by a Shell.
+type ShellScript interface {
+	// Run runs the script in dir with the environment env until ctx is done.
+	// It returns the exit status of the script, or an error if the script
+	// could not run.
+	Run(ctx context.Context, dir string, env []string, stdin io.Reader, stdout, stderr io.Writer) (exitCode int, err error)
+}
+
+// embeddedShell is the registered shell interpreter, nil if none
+var embeddedShell Shell
+
+// RegisterShell sets the interpreter used by EmbeddedShell. It is called
+// by the shell package when it is imported.
+func RegisterShell(sh Shell) {
+	embeddedShell = sh
+}
+
+// parseEmbedded parses script for the embedded shell. It returns nil if no
+// shell is registered or the script needs bash.
+func parseEmbedded(script string) ShellScript {
+	if embeddedShell == nil {
+		logVerbose("#", "running with bash: import gopkg.in/godo.v2/shell for the embedded shell\n")
+		return nil
+	}
+	parsed, err := embeddedShell.Parse(script)
+	if err != nil {
+		logVerbose("#", "running with bash: %s\n", err.Error())
+		return nil
+	}
+	return parsed
+}
+
+// interpret runs the script of the command with the embedded shell.
+func (gcmd *command) interpret() (string, error) {
+	stdin, stdout, stderr := gcmd.stdio()
+	gcmd.debug()
+	gcmd.started = time.Now()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if gcmd.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, gcmd.timeout)
+		defer cancel()
+	}
+	if gcmd.context != nil && gcmd.context.inv != nil {
+		go func() {
+			select {
+			case <-gcmd.context.inv.cancelled:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	code, err := gcmd.script.Run(ctx, gcmd.wd, gcmd.environ(), stdin, stdout, stderr)
+	if ctx.Err() == context.DeadlineExceeded {
+		return gcmd.finish(-1, fmt.Errorf("%w after %s", ErrTimeout, gcmd.timeout))
+	}
+	if err != nil {
+		return gcmd.finish(-1, err)
+	}
+	if code != 0 {
+		return gcmd.finish(code, fmt.Errorf("exit status %d", code))
+	}
+	return gcmd.finish(0, nil)
+}
@@ -0,0 +1,102 @@
+// Package shell registers a shell interpreter, mvdan.cc/sh, with godo to
+// run bash scripts when godo.EmbeddedShell is set. Import it for its side
+// effect:
+//
+//		import _ "gopkg.in/godo.v2/shell"
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/godo.v2"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+func init() {
+	godo.RegisterShell(interpreter{})
+}
+
+// bashOnlyBuiltins are bash builtins the interpreter does not implement.
+var bashOnlyBuiltins = map[string]bool{
+	"bg":       true,
+	"bind":     true,
+	"caller":   true,
+	"compgen":  true,
+	"complete": true,
+	"compopt":  true,
+	"disown":   true,
+	"enable":   true,
+	"fc":       true,
+	"fg":       true,
+	"help":     true,
+	"history":  true,
+	"jobs":     true,
+	"kill":     true,
+	"logout":   true,
+	"newgrp":   true,
+	"suspend":  true,
+	"times":    true,
+	"ulimit":   true,
+	"umask":    true,
+}
+
+// interpreter runs scripts with mvdan.cc/sh.
+type interpreter struct{}
+
+// Parse parses src. It returns an error if the script does not parse or
+// uses features which need bash.
+func (interpreter) Parse(src string) (godo.ShellScript, error) {
+	file, err := syntax.NewParser(syntax.Variant(syntax.LangBash)).Parse(strings.NewReader(src), "")
+	if err != nil {
+		return nil, err
+	}
+
+	reason := ""
+	syntax.Walk(file, func(node syntax.Node) bool {
+		switch n := node.(type) {
+		case *syntax.CoprocClause:
+			reason = "coproc"
+		case *syntax.CallExpr:
+			if len(n.Args) > 0 && bashOnlyBuiltins[n.Args[0].Lit()] {
+				reason = n.Args[0].Lit()
+			}
+		}
+		return reason == ""
+	})
+	if reason != "" {
+		return nil, fmt.Errorf("%s is not supported by the embedded shell", reason)
+	}
+	return script{file}, nil
+}
+
+// script is a parsed script.
+type script struct {
+	file *syntax.File
+}
+
+// Run runs the script and returns its exit status.
+func (s script) Run(ctx context.Context, dir string, env []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	runner, err := interp.New(
+		interp.Dir(dir),
+		interp.Env(expand.ListEnviron(env...)),
+		interp.StdIO(stdin, stdout, stderr),
+	)
+	if err != nil {
+		return -1, err
+	}
+	err = runner.Run(ctx, s.file)
+	var status interp.ExitStatus
+	if errors.As(err, &status) {
+		return int(status), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
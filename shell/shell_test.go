@@ -0,0 +1,61 @@
+package shell
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	do "gopkg.in/godo.v2"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestEmbeddedShell(t *testing.T) {
+	result, err := do.BashCommand(`echo -n "$$ $EMBEDDED_A $(basename "$PWD")"; echo -n oops >&2; exit 4`).
+		Embedded(true).
+		Env("EMBEDDED_A=a").
+		Dir("../test").
+		Stdout(&bytes.Buffer{}).
+		Stderr(&bytes.Buffer{}).
+		Capture().
+		Run(nil)
+	assert.Error(t, err)
+	assert.Equal(t, 4, result.ExitCode)
+	assert.Equal(t, strconv.Itoa(os.Getpid())+" a test", result.Stdout)
+	assert.Equal(t, "oops", result.Stderr)
+}
+
+func TestEmbeddedShellOption(t *testing.T) {
+	do.EmbeddedShell = true
+	defer func() {
+		do.EmbeddedShell = false
+	}()
+	output, err := do.BashOutput(`echo -n $$`)
+	assert.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid()), output)
+	wd, _ := os.Getwd()
+	output, _ = do.BashOutput(`echo -n $PWD`, do.M{"$in": "../test"})
+	assert.Equal(t, filepath.Join(wd, "../test"), output)
+}
+
+func TestEmbeddedShellFallback(t *testing.T) {
+	parse := func(script string) error {
+		_, err := interpreter{}.Parse(script)
+		return err
+	}
+	assert.NoError(t, parse(`for f in *.go; do echo "$f"; done | sort`))
+	assert.Error(t, parse(`ulimit -n 1024`))
+	assert.Error(t, parse(`coproc cat`))
+	assert.Error(t, parse(`if then`))
+	if runtime.GOOS == "windows" {
+		return
+	}
+	output, err := do.BashCommand(`echo -n $$`).Embedded(true).Stdout(&bytes.Buffer{}).Capture().Run(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid()), output.Output)
+	output, err = do.BashCommand(`ulimit -n >/dev/null; echo -n $$`).Embedded(true).Stdout(&bytes.Buffer{}).Capture().Run(nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, strconv.Itoa(os.Getpid()), output.Output)
+}
@@ -0,0 +1,327 @@
+package godo
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// shellWord is a word parsed from a command string.
+type shellWord struct {
+	text string
+	// assign is set for an unquoted NAME=value word
+	assign bool
+}
+
+// shellCommand is a command parsed from a command string.
+type shellCommand struct {
+	// line is the line of the command string on which the command starts
+	line  int
+	words []shellWord
+}
+
+// SplitWords splits s into words using POSIX shell rules:
+//
+//   - Words are separated by unquoted spaces, tabs and newlines.
+//   - Single quotes preserve every character up to the closing quote.
+//   - Double quotes preserve every character except $ and a backslash
+//     before $, `, ", \ or newline.
+//   - An unquoted backslash preserves the next character. On Windows a
+//     backslash is literal unless it is followed by a double quote, so there
+//     are no line continuations.
+//   - Backslash-newline is a line continuation and is removed.
+//   - $NAME and ${NAME} are expanded with getenv except in single quotes.
+//     The value is not split into words. A nil getenv disables expansion.
+//
+// Unlike a shell, variables assigned by a NAME=value prefix are visible to
+// the words which follow them.
+func SplitWords(s string, getenv func(string) string) ([]string, error) {
+	commands, err := parseCommands(s, getenv)
+	if err != nil {
+		return nil, err
+	}
+	var words []string
+	for _, command := range commands {
+		for _, word := range command.words {
+			words = append(words, word.text)
+		}
+	}
+	return words, nil
+}
+
+// split splits the command into its environment prefix, executable and
+// arguments.
+func (sc *shellCommand) split() (executable string, argv, env []string, err error) {
+	for i, word := range sc.words {
+		if word.assign {
+			env = append(env, word.text)
+			continue
+		}
+		executable = word.text
+		for _, w := range sc.words[i+1:] {
+			argv = append(argv, w.text)
+		}
+		return
+	}
+	return "", nil, nil, fmt.Errorf("missing executable on line %d", sc.line)
+}
+
+// parseCommands parses s into commands separated by unquoted newlines.
+func parseCommands(s string, getenv func(string) string) ([]*shellCommand, error) {
+	p := &wordParser{s: s, getenv: getenv}
+	return p.parse()
+}
+
+type wordParser struct {
+	s      string
+	i      int
+	line   int
+	getenv func(string) string
+
+	commands []*shellCommand
+	command  *shellCommand
+	// prefix are the assignments before the executable of command
+	prefix map[string]string
+
+	word   []byte
+	inWord bool
+	// nameOK is set while the word may still be a NAME=value assignment
+	nameOK bool
+	assign bool
+	// quoted is set if the word has quotes, so it is kept even if empty
+	quoted bool
+}
+
+func (p *wordParser) parse() ([]*shellCommand, error) {
+	p.newCommand()
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.endWord()
+			p.i++
+		case c == '\n':
+			p.endWord()
+			p.endCommand()
+			p.i++
+			p.line++
+			p.newCommand()
+		case c == '\'':
+			p.startWord()
+			p.nameOK = false
+			p.quoted = true
+			end := strings.IndexByte(p.s[p.i+1:], '\'')
+			if end < 0 {
+				return nil, p.errorf("unterminated single quote")
+			}
+			quoted := p.s[p.i+1 : p.i+1+end]
+			p.line += strings.Count(quoted, "\n")
+			p.word = append(p.word, quoted...)
+			p.i += end + 2
+		case c == '"':
+			p.startWord()
+			p.nameOK = false
+			p.quoted = true
+			if err := p.doubleQuoted(); err != nil {
+				return nil, err
+			}
+		case c == '\\':
+			if runtime.GOOS == "windows" && !strings.HasPrefix(p.s[p.i:], `\"`) {
+				p.literal(c)
+				p.i++
+				continue
+			}
+			if p.i+1 == len(p.s) {
+				return nil, p.errorf("escape character at end of string")
+			}
+			next := p.s[p.i+1]
+			p.i += 2
+			if next == '\n' {
+				p.line++
+				continue
+			}
+			p.startWord()
+			p.nameOK = false
+			p.word = append(p.word, next)
+		case c == '$':
+			p.startWord()
+			p.nameOK = false
+			p.expand()
+		default:
+			p.literal(c)
+			p.i++
+		}
+	}
+	p.endWord()
+	p.endCommand()
+	return p.commands, nil
+}
+
+// doubleQuoted parses a double quoted string starting at the opening quote.
+func (p *wordParser) doubleQuoted() error {
+	p.i++
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		switch c {
+		case '"':
+			p.i++
+			return nil
+		case '\\':
+			if p.i+1 < len(p.s) && strings.IndexByte("$`\"\\\n", p.s[p.i+1]) >= 0 {
+				next := p.s[p.i+1]
+				p.i += 2
+				if next == '\n' {
+					p.line++
+					continue
+				}
+				p.word = append(p.word, next)
+				continue
+			}
+			p.word = append(p.word, c)
+			p.i++
+		case '$':
+			p.expand()
+		default:
+			if c == '\n' {
+				p.line++
+			}
+			p.word = append(p.word, c)
+			p.i++
+		}
+	}
+	return p.errorf("unterminated double quote")
+}
+
+// expand expands the variable at the $.
+func (p *wordParser) expand() {
+	start := p.i
+	p.i++
+	name := ""
+	if p.i < len(p.s) && p.s[p.i] == '{' {
+		end := strings.IndexByte(p.s[p.i:], '}')
+		if end > 0 && isName(p.s[p.i+1:p.i+end]) {
+			name = p.s[p.i+1 : p.i+end]
+			p.i += end + 1
+		}
+	} else {
+		end := p.i
+		for end < len(p.s) && isNameChar(p.s[end], end == p.i) {
+			end++
+		}
+		name = p.s[p.i:end]
+		p.i = end
+	}
+
+	if name == "" || p.getenv == nil {
+		// not a variable
+		p.word = append(p.word, p.s[start:p.i]...)
+		return
+	}
+	if value, ok := p.prefix[name]; ok {
+		p.word = append(p.word, value...)
+		return
+	}
+	p.word = append(p.word, p.getenv(name)...)
+}
+
+// literal adds an unquoted character to the current word.
+func (p *wordParser) literal(c byte) {
+	p.startWord()
+	if p.nameOK && !p.assign {
+		if c == '=' && len(p.word) > 0 {
+			p.assign = true
+		} else if !isNameChar(c, len(p.word) == 0) {
+			p.nameOK = false
+		}
+	}
+	p.word = append(p.word, c)
+}
+
+func (p *wordParser) startWord() {
+	if p.inWord {
+		return
+	}
+	p.inWord = true
+	p.word = p.word[:0]
+	p.nameOK = true
+	p.assign = false
+	p.quoted = false
+}
+
+func (p *wordParser) endWord() {
+	if !p.inWord {
+		return
+	}
+	p.inWord = false
+	if len(p.word) == 0 && !p.quoted {
+		// unquoted expansion of an empty variable
+		return
+	}
+	word := shellWord{text: string(p.word), assign: p.assign}
+
+	// only leading assignments set the environment
+	prefix := true
+	for _, w := range p.command.words {
+		prefix = prefix && w.assign
+	}
+	if word.assign && prefix {
+		pair := splitKV(word.text)
+		p.prefix[pair[0]] = pair[1]
+	} else {
+		word.assign = false
+	}
+	p.command.words = append(p.command.words, word)
+}
+
+func (p *wordParser) newCommand() {
+	p.command = &shellCommand{line: p.line}
+	p.prefix = map[string]string{}
+}
+
+func (p *wordParser) endCommand() {
+	if len(p.command.words) > 0 {
+		p.commands = append(p.commands, p.command)
+	}
+}
+
+func (p *wordParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf(format+" on line %d", append(args, p.command.line)...)
+}
+
+// Quote quotes s for SplitWords and POSIX shells if it contains any
+// character other than letters, digits and -_./:,@%+.
+func Quote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !isNameChar(c, false) && strings.IndexByte("-./:,@%+", c) < 0 {
+			return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+		}
+	}
+	return s
+}
+
+// quoteWords joins words into a command string.
+func quoteWords(words []string) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = Quote(word)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// isName determines if s is a valid environment variable name.
+func isName(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isNameChar(s[i], i == 0) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isNameChar(c byte, first bool) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || !first && c >= '0' && c <= '9'
+}
@@ -0,0 +1,111 @@
+package godo
+
+import (
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestSplitWords(t *testing.T) {
+	getenv := func(key string) string {
+		return map[string]string{"HOME": "/home/mario", "EMPTY": ""}[key]
+	}
+	words, err := SplitWords(`echo 'single $HOME' "double $HOME" ${HOME}/bin "q\"uote"
+		--flag=value $EMPTY "" '' $1`, getenv)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"echo", "single $HOME", "double /home/mario", "/home/mario/bin", `q"uote`,
+		"--flag=value", "", "", "$1",
+	}, words)
+
+	words, err = SplitWords(`a\ b \
+		c`, nil)
+	assert.NoError(t, err)
+	if isWindows {
+		// a backslash is literal unless it is followed by a double quote
+		assert.Equal(t, []string{`a\`, "b", `\`, "c"}, words)
+	} else {
+		assert.Equal(t, []string{"a b", "c"}, words)
+	}
+
+	words, err = SplitWords(`echo $HOME`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"echo", "$HOME"}, words)
+
+	words, err = SplitWords(`echo ${HOME}/bin "${HOME}"`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"echo", "${HOME}/bin", "${HOME}"}, words)
+
+	_, err = SplitWords(`echo "unterminated`, nil)
+	assert.Error(t, err)
+	_, err = SplitWords(`echo 'unterminated`, nil)
+	assert.Error(t, err)
+}
+
+func TestParseCommands(t *testing.T) {
+	commands, err := parseCommands(`
+		FOO=bar BAH="a b" env A=b
+		"X=y" cmd
+		cat file.txt
+		`, func(string) string { return "" })
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(commands))
+
+	executable, argv, env, err := commands[0].split()
+	assert.NoError(t, err)
+	assert.Equal(t, "env", executable)
+	assert.Equal(t, []string{"A=b"}, argv)
+	assert.Equal(t, []string{"FOO=bar", "BAH=a b"}, env)
+	assert.Equal(t, 1, commands[0].line)
+
+	executable, argv, env, _ = commands[1].split()
+	assert.Equal(t, "X=y", executable)
+	assert.Equal(t, []string{"cmd"}, argv)
+	assert.Nil(t, env)
+
+	executable, argv, _, _ = commands[2].split()
+	assert.Equal(t, "cat", executable)
+	assert.Equal(t, []string{"file.txt"}, argv)
+	assert.Equal(t, 3, commands[2].line)
+
+	// a backslash is literal on Windows, so there are no line continuations
+	if !isWindows {
+		commands, err = parseCommands("cat \\\n\tfile.txt\necho", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(commands))
+		_, argv, _, _ = commands[0].split()
+		assert.Equal(t, []string{"file.txt"}, argv)
+		assert.Equal(t, 2, commands[1].line)
+	}
+
+	_, _, _, err = splitCommand("FOO=bar", nil)
+	assert.Error(t, err)
+}
+
+func TestQuote(t *testing.T) {
+	assert.Equal(t, "plain-word/1.0", Quote("plain-word/1.0"))
+	assert.Equal(t, "''", Quote(""))
+	assert.Equal(t, `'it'\''s $HOME'`, Quote("it's $HOME"))
+
+	words, _ := SplitWords(quoteWords([]string{"git", "commit", "-m", "it's \"done\""}), nil)
+	assert.Equal(t, []string{"git", "commit", "-m", "it's \"done\""}, words)
+}
+
+func TestCmd(t *testing.T) {
+	if isWindows {
+		return
+	}
+	var output string
+	tasks := func(p *Project) {
+		p.Task("foo", nil, func(c *Context) {
+			c.Cmd("bash", "-c", `test "$0" = 'it'"'"'s $HOME'`, "it's $HOME")
+			if c.Error == nil {
+				output = "ok"
+			}
+		})
+	}
+	_, err := runTask(tasks, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", output)
+	assert.Error(t, Cmd("bash", "-c", "exit 1"))
+}
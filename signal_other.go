@@ -0,0 +1,12 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package godo
+
+import "os"
+
+// exitSignal returns "" as the signal of a process is not known on this
+// platform.
+func exitSignal(state *os.ProcessState) string {
+	return ""
+}
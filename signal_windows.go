@@ -0,0 +1,8 @@
+package godo
+
+import "os"
+
+// exitSignal returns "" as processes are not killed by signals on Windows.
+func exitSignal(state *os.ProcessState) string {
+	return ""
+}
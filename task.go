@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"path/filepath"
+	"runtime/debug"
 	"strings"
 	"sync"
 	"time"
@@ -56,6 +57,33 @@ type Task struct {
 	// when time has elapsed
 	sync.Mutex
 	ignoreEvents bool
+
+	// liveReload reloads browsers after a watch-triggered run succeeds
+	liveReload bool
+	// proxy fronts a server started by this task
+	proxy *DevProxy
+	// env overlays the environment of commands run from this task
+	env []string
+	// retry reruns the handler if it fails
+	retry *retryPolicy
+	// resources are the names of the resources the task uses and how many
+	// tasks may use each at a time
+	resources map[string]int
+	// fileLock keeps other godo processes from running the task at the
+	// same time
+	fileLock *fileLock
+	// when and unless are the conditions which decide whether the task runs
+	when   []Condition
+	unless []Condition
+	// onFailure and finally are the tasks run after the task
+	onFailure []string
+	finally   []string
+	// matrix is the combination of a sub-task of a matrix task
+	matrix map[string]string
+	// project is the project the task was added to
+	project *Project
+	// outputs are the values set with Context#SetOutput in the last run
+	outputs M
 }
 
 // NewTask creates a new Task.
@@ -70,6 +98,10 @@ func NewTask(name string, argm minimist.ArgMap) *Task {
 
 // Expands glob patterns.
 func (task *Task) expandGlobs() {
+	// watch runs of several tasks may expand the globs of a shared
+	// dependency at the same time
+	task.Lock()
+	defer task.Unlock()
 
 	// runs once lazily
 	if len(task.SrcFiles) > 0 {
@@ -99,15 +131,60 @@ func (task *Task) expandGlobs() {
 // Run runs all the dependencies of this task and when they have completed,
 // runs this task.
 func (task *Task) Run() error {
-	if !watching && task.Complete {
+	if !watching && task.isComplete() {
 		util.Debug(task.Name, "Already ran\n")
 		return nil
 	}
 	return task.RunWithEvent(task.Name, nil)
 }
 
+// qualifiedName returns the name of the task including its namespace, e.g.
+// "sub:lint".
+func (task *Task) qualifiedName() string {
+	if task.project == nil || task.project.parent == nil {
+		return task.Name
+	}
+	return strings.TrimPrefix(task.project.ns, "root:") + ":" + task.Name
+}
+
+// isComplete determines if the task already ran.
+func (task *Task) isComplete() bool {
+	task.Lock()
+	defer task.Unlock()
+	return task.Complete
+}
+
+// setComplete sets whether the task already ran.
+func (task *Task) setComplete(complete bool) {
+	task.Lock()
+	task.Complete = complete
+	task.Unlock()
+}
+
+// srcFiles returns the files matched by the Src globs once they are
+// expanded.
+func (task *Task) srcFiles() []*glob.FileAsset {
+	task.Lock()
+	defer task.Unlock()
+	return task.SrcFiles
+}
+
 // isWatchedFile determines if a FileEvent's file is a watched file
 func (task *Task) isWatchedFile(path string) bool {
+	return matchesFile(task.EffectiveWatchRegexps, path)
+}
+
+// srcRegexps returns the regexps of the Src globs, expanding them if needed.
+func (task *Task) srcRegexps() []*glob.RegexpInfo {
+	task.expandGlobs()
+	task.Lock()
+	defer task.Unlock()
+	return task.SrcRegexps
+}
+
+// matchesFile determines if path matches regexps, taking negated patterns
+// into account.
+func matchesFile(regexps []*glob.RegexpInfo, path string) bool {
 	filename, err := filepath.Rel(wd, path)
 	if err != nil {
 		return false
@@ -117,7 +194,7 @@ func (task *Task) isWatchedFile(path string) bool {
 	//util.Debug("task", "checking for match %s\n", filename)
 
 	matched := false
-	for _, info := range task.EffectiveWatchRegexps {
+	for _, info := range regexps {
 		if info.Negate {
 			if matched {
 				matched = !info.MatchString(filename)
@@ -137,7 +214,12 @@ func (task *Task) isWatchedFile(path string) bool {
 // *e* FileEvent contains information about the file/directory which changed
 // in watch mode.
 func (task *Task) RunWithEvent(logName string, e *watcher.FileEvent) (err error) {
-	if task.RunOnce && task.Complete {
+	return task.run(logName, newInvocation(e))
+}
+
+func (task *Task) run(logName string, inv *invocation) (err error) {
+	e := inv.event
+	if task.RunOnce && task.isComplete() && inv.hook != task && !inv.forced {
 		util.Debug(task.Name, "Already ran\n")
 		return nil
 	}
@@ -149,7 +231,7 @@ func (task *Task) RunWithEvent(logName string, e *watcher.FileEvent) (err error)
 	}
 
 	start := time.Now()
-	if len(task.SrcGlobs) > 0 && len(task.SrcFiles) == 0 {
+	if len(task.SrcGlobs) > 0 && len(task.srcFiles()) == 0 {
 		util.Error("task", "\""+task.Name+"\" '%v' did not match any files\n", task.SrcGlobs)
 	}
 
@@ -165,22 +247,28 @@ func (task *Task) RunWithEvent(logName string, e *watcher.FileEvent) (err error)
 		}
 	}
 
-	log := true
-	if task.Handler != nil {
-		context := Context{Task: task, Args: task.argm, FileEvent: e}
+	if task.proxy != nil {
+		task.proxy.start()
+		task.proxy.beginBuild(logName)
 		defer func() {
-			if p := recover(); p != nil {
-				sp, ok := p.(*softPanic)
-				if !ok {
-					panic(p)
-				}
-				err = fmt.Errorf("%q: %s", logName, sp)
-			}
+			task.proxy.endBuild(err)
 		}()
+	}
 
-		task.Handler.Handle(&context)
-		if context.Error != nil {
-			return fmt.Errorf("%q: %s", logName, context.Error.Error())
+	log := true
+	if task.Handler != nil {
+		err = task.retry.do(logName, inv.cancelled, func() (*Result, error) {
+			task.resetOutputs()
+			context := &Context{Task: task, Args: profileArgs(task.argm), FileEvent: e, inv: inv, logName: logName}
+			err := task.handle(context)
+			return context.failed, err
+		})
+		if inv.isCancelled() {
+			return errRunCancelled
+		}
+		inv.record(task, logName, start, err)
+		if err != nil {
+			return fmt.Errorf("%q: %w", logName, err)
 		}
 	} else if len(task.dependencies) > 0 {
 		// no need to log if just dependency
@@ -198,11 +286,41 @@ func (task *Task) RunWithEvent(logName string, e *watcher.FileEvent) (err error)
 		}
 	}
 
-	task.Complete = true
+	task.setComplete(true)
+
+	if task.liveReload && e != nil {
+		kind := reloadKind(e.Path)
+		if task.proxy != nil {
+			// a server started with Start may not be listening yet
+			go func() {
+				if task.proxy.waitBackend(time.After(task.proxy.Timeout), inv.cancelled) {
+					liveReload.broadcast(kind)
+				}
+			}()
+		} else {
+			liveReload.broadcast(kind)
+		}
+	}
 
 	return nil
 }
 
+// handle runs the handler once with context. A panic fails the task.
+func (task *Task) handle(context *Context) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			if sp, ok := p.(*softPanic); ok {
+				err = sp.err
+				return
+			}
+			err = &PanicError{Value: p, Stack: debug.Stack()}
+		}
+	}()
+
+	task.Handler.Handle(context)
+	return context.Error
+}
+
 // DependencyNames gets the flattened dependency names.
 func (task *Task) DependencyNames() []string {
 	if len(task.dependencies) == 0 {
@@ -221,6 +339,8 @@ func (task *Task) DependencyNames() []string {
 			deps = append(deps, Series(d).names()...)
 		case P:
 			deps = append(deps, Parallel(d).names()...)
+		case LazyDeps:
+			// unknown until the task runs
 		}
 	}
 	return deps
@@ -235,7 +355,7 @@ func (task *Task) dump(buf io.Writer, indent string) {
 }
 
 func (task *Task) shouldRun(e *watcher.FileEvent) bool {
-	if e == nil || len(task.SrcFiles) == 0 {
+	if e == nil || len(task.srcFiles()) == 0 {
 		return true
 	} else if !task.isWatchedFile(e.Path) {
 		// fmt.Printf("received a file so it should return immediately\n")
@@ -245,6 +365,9 @@ func (task *Task) shouldRun(e *watcher.FileEvent) bool {
 	// lazily expand globs
 	task.expandGlobs()
 
+	// watch runs sharing the task stat its files at the same time
+	task.Lock()
+	defer task.Unlock()
 	if len(task.SrcFiles) == 0 || len(task.DestFiles) == 0 {
 		// fmt.Printf("no source files %s %#v\n", task.Name, task.SrcFiles)
 		// fmt.Printf("no source files %s %#v\n", task.Name, task.DestFiles)
@@ -27,6 +27,10 @@ func (s Series) names() []string {
 			names = append(names, t.names()...)
 		case Parallel:
 			names = append(names, t.names()...)
+		case S:
+			names = append(names, Series(t).names()...)
+		case P:
+			names = append(names, Parallel(t).names()...)
 		}
 
 	}
@@ -50,6 +54,10 @@ func (p Parallel) names() []string {
 			names = append(names, t.names()...)
 		case Parallel:
 			names = append(names, t.names()...)
+		case S:
+			names = append(names, Series(t).names()...)
+		case P:
+			names = append(names, Parallel(t).names()...)
 		}
 
 	}
@@ -58,6 +66,25 @@ func (p Parallel) names() []string {
 
 func (p Parallel) markAsDependency() {}
 
+// LazyDeps are dependencies computed by a func each time they run, so a
+// graph can be built from the filesystem without slowing down every godo
+// command. The func may add tasks to the project and return their names. It
+// is called once per run. Until then its tasks are unknown, so they are not
+// listed by DependencyNames or usage and their Src is not watched; a watch
+// run reruns a task with LazyDeps on any change.
+type LazyDeps func() Dependency
+
+func (l LazyDeps) markAsDependency() {}
+
+// resolve calls l and returns its dependencies as a Series.
+func (l LazyDeps) resolve(parentName string) Series {
+	dep := toDependency(parentName, l())
+	if dep == nil {
+		return Series{}
+	}
+	return Series{dep}
+}
+
 // S is alias for Series
 type S []interface{}
 
@@ -79,21 +106,75 @@ func (task *Task) Debounce(duration time.Duration) *Task {
 // Deps are task dependencies and must specify how to run tasks in series or in parallel.
 func (task *Task) Deps(names ...interface{}) {
 	for _, name := range names {
-		switch dep := name.(type) {
-		default:
-			util.Error(task.Name, "Dependency types must be (string | P | Parallel | S | Series)")
-		case string:
-			task.dependencies = append(task.dependencies, dep)
-		case P:
-			task.dependencies = append(task.dependencies, Parallel(dep))
-		case Parallel:
+		if dep := toDependency(task.Name, name); dep != nil {
 			task.dependencies = append(task.dependencies, dep)
+		}
+	}
+}
+
+// DepsFunc adds dependencies computed by fn each time the task runs. See
+// LazyDeps.
+//
+//		p.Task1("test", testAll).DepsFunc(func() do.Dependency {
+//			var names do.P
+//			for _, pkg := range packages() {
+//				names = append(names, "test-"+pkg)
+//			}
+//			return names
+//		})
+func (task *Task) DepsFunc(fn func() Dependency) *Task {
+	task.dependencies = append(task.dependencies, LazyDeps(fn))
+	return task
+}
+
+// hasLazyDeps determines if steps contain LazyDeps.
+func hasLazyDeps(steps []interface{}) bool {
+	for _, step := range steps {
+		switch t := step.(type) {
+		case LazyDeps:
+			return true
 		case S:
-			task.dependencies = append(task.dependencies, Series(dep))
+			if hasLazyDeps(t) {
+				return true
+			}
 		case Series:
-			task.dependencies = append(task.dependencies, dep)
+			if hasLazyDeps(t) {
+				return true
+			}
+		case P:
+			if hasLazyDeps(t) {
+				return true
+			}
+		case Parallel:
+			if hasLazyDeps(t) {
+				return true
+			}
 		}
 	}
+	return false
+}
+
+// toDependency normalizes a dependency of task name. It returns nil for
+// invalid types.
+func toDependency(name string, v interface{}) interface{} {
+	switch dep := v.(type) {
+	case string:
+		return dep
+	case P:
+		return Parallel(dep)
+	case Parallel:
+		return dep
+	case S:
+		return Series(dep)
+	case Series:
+		return dep
+	case LazyDeps:
+		return dep
+	case nil:
+		return nil
+	}
+	util.Error(name, "Dependency types must be (string | P | Parallel | S | Series | LazyDeps)")
+	return nil
 }
 
 // Description sets the description for the task.
@@ -119,6 +200,128 @@ func (task *Task) Dest(globs ...string) *Task {
 	return task
 }
 
+// Env adds key=value pairs to the environment of every command run from
+// this task's Context. The process environment is not changed.
+func (task *Task) Env(kvs ...string) *Task {
+	for _, kv := range kvs {
+		task.env = append(task.env, ParseStringEnv(kv)...)
+	}
+	return task
+}
+
+// LiveReload reloads connected browsers whenever a watch-triggered run of
+// this task succeeds. Changes to stylesheets only refresh CSS. Add the
+// script returned by LiveReloadScript() to the pages to reload.
+//
+// If the task starts a server with Start, also front it with Proxy, so
+// browsers reload once the server accepts connections. Otherwise they
+// reload as soon as the task returns, possibly before the server listens.
+func (task *Task) LiveReload() *Task {
+	task.liveReload = true
+	return task
+}
+
+// FileLock keeps other godo processes, for example one started in another
+// terminal, from running the task at the same time. wait is LockWait to wait
+// for the other process, LockFailFast to fail right away or how long to wait
+// before failing. The lock file is in LockDir.
+func (task *Task) FileLock(wait time.Duration) *Task {
+	task.fileLock = &fileLock{wait: wait}
+	return task
+}
+
+// Finally runs tasks names after the task, in reverse order, even if the
+// task or one of its dependencies fails or the run is interrupted.
+//
+//		p.Task("integration", do.S{"compose-up"}, integration).Finally("compose-down")
+func (task *Task) Finally(names ...string) *Task {
+	task.finally = append(task.finally, names...)
+	return task
+}
+
+// Exclusive prevents the task from running at the same time as other tasks
+// which are exclusive on any of names, for example tasks which use the same
+// database in Parallel branches. Other tasks still run concurrently.
+//
+//		p.Task("test-db", nil, testDB).Exclusive("db")
+//		p.Task("seed", nil, seed).Exclusive("db")
+func (task *Task) Exclusive(names ...string) *Task {
+	for _, name := range names {
+		task.Resources(name, 1)
+	}
+	return task
+}
+
+// OnFailure runs tasks names, in reverse order, if the task or one of its
+// dependencies fails. They run before the Finally tasks.
+func (task *Task) OnFailure(names ...string) *Task {
+	task.onFailure = append(task.onFailure, names...)
+	return task
+}
+
+// Proxy fronts the server started by this task with a reverse proxy
+// listening on addr. Requests are held while the task reruns and until
+// backend accepts connections. If the task fails, requests are answered with
+// the error.
+//
+//		p.Task("server", nil, func(c *do.Context) {
+//			c.Start("main.go", do.M{"$in": "cmd/server"})
+//		}).Src("**/*.go").Proxy(":3000", "localhost:8080")
+func (task *Task) Proxy(addr string, backend string) *Task {
+	task.proxy = NewDevProxy(addr, backend)
+	return task
+}
+
+// Resources declares the task uses resource name, which at most n tasks may
+// use at a time. Tasks which share a resource must declare the same n,
+// otherwise they fail when they run.
+//
+//		p.Task("e2e", nil, e2e).Resources("port:8080", 1)
+func (task *Task) Resources(name string, n int) *Task {
+	if n < 1 {
+		n = 1
+	}
+	if task.resources == nil {
+		task.resources = map[string]int{}
+	}
+	task.resources[name] = n
+	return task
+}
+
+// Retry reruns the task handler up to n times if it fails, waiting backoff
+// before the first retry and doubling the wait after each retry. Each
+// attempt runs with a new Context. Retries stop when the run is cancelled.
+//
+//		p.Task("deploy", nil, func(c *do.Context) {
+//			c.Run("kubectl apply -f deploy.yaml")
+//		}).Retry(2, 5*time.Second).RetryOnOutput("connection refused")
+func (task *Task) Retry(n int, backoff time.Duration) *Task {
+	task.retryPolicy().setRetry(n, backoff)
+	return task
+}
+
+// RetryOnExit only retries the task if the command which failed it exited
+// with one of codes.
+func (task *Task) RetryOnExit(codes ...int) *Task {
+	task.retryPolicy().onExit(codes)
+	return task
+}
+
+// RetryOnOutput only retries the task if the output of the command which
+// failed it, or the error, matches one of the regular expressions in
+// patterns.
+func (task *Task) RetryOnOutput(patterns ...string) *Task {
+	task.retryPolicy().onOutput(patterns)
+	return task
+}
+
+func (task *Task) retryPolicy() *retryPolicy {
+	if task.retry == nil {
+		task.retry = &retryPolicy{}
+	}
+	return task.retry
+}
+
 // Src adds a source globs to this task. The task is
 // not run unless files are outdated between Src and Dest globs.
 func (task *Task) Src(globs ...string) *Task {
@@ -127,3 +330,21 @@ func (task *Task) Src(globs ...string) *Task {
 	}
 	return task
 }
+
+// Unless skips the task and its dependencies if any of conds holds. The
+// task is logged as skipped with the reason.
+//
+//		p.Task("install", nil, install).Unless(do.FileExists("node_modules"))
+func (task *Task) Unless(conds ...Condition) *Task {
+	task.unless = append(task.unless, conds...)
+	return task
+}
+
+// When skips the task and its dependencies unless all of conds hold. The
+// task is logged as skipped with the reason.
+//
+//		p.Task("publish", nil, publish).When(do.EnvSet("CI"), do.CommandSucceeds("git diff --quiet"))
+func (task *Task) When(conds ...Condition) *Task {
+	task.when = append(task.when, conds...)
+	return task
+}
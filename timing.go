@@ -0,0 +1,280 @@
+package godo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimingsFile stores how long tasks took in previous runs. The durations
+// are used to start the tasks on the critical path of a Parallel first. It
+// is only written if Gododir exists.
+var TimingsFile = filepath.Join("Gododir", ".godo", "timings.json")
+
+// idleMin is the shortest idle time shown in the timing summary.
+var idleMin = 10 * time.Millisecond
+
+// taskTimings are the durations of tasks in previous runs by task key.
+type taskTimings struct {
+	durations map[string]time.Duration
+	sync.Mutex
+}
+
+var timings = &taskTimings{durations: map[string]time.Duration{}}
+
+// get returns the last duration of the task key, 0 if unknown.
+func (t *taskTimings) get(key string) time.Duration {
+	t.Lock()
+	defer t.Unlock()
+	return t.durations[key]
+}
+
+// set records the duration of the task key.
+func (t *taskTimings) set(key string, d time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+	t.durations[key] = d
+}
+
+// load reads the durations saved in path. A missing file is not an error.
+func (t *taskTimings) load(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	durations := map[string]time.Duration{}
+	if err := json.Unmarshal(b, &durations); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	t.Lock()
+	defer t.Unlock()
+	for key, d := range durations {
+		t.durations[key] = d
+	}
+	return nil
+}
+
+// save writes the durations to path. It does nothing if the parent of the
+// directory of path, e.g. Gododir, does not exist. The file is replaced at
+// once, so godo processes running at the same time do not corrupt it.
+func (t *taskTimings) save(path string) error {
+	dir := filepath.Dir(path)
+	if _, err := os.Stat(filepath.Dir(dir)); os.IsNotExist(err) {
+		return nil
+	}
+	t.Lock()
+	b, err := json.MarshalIndent(t.durations, "", "  ")
+	t.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// key identifies task across runs.
+func (task *Task) key() string {
+	if task.project == nil {
+		return task.Name
+	}
+	return task.project.ns + ":" + task.Name
+}
+
+// estimate returns how long step is expected to take from the durations of
+// previous runs, including dependencies which have not run yet. The
+// dependencies of LazyDeps are unknown until they run and count as 0.
+func (project *Project) estimate(step interface{}, inv *invocation, memo map[*Task]time.Duration) time.Duration {
+	var total time.Duration
+	switch t := step.(type) {
+	case string:
+		proj, task, _ := project.mustTask(t)
+		if d, ok := memo[task]; ok {
+			return d
+		}
+		// guards against cycles
+		memo[task] = 0
+		if !inv.hasRun(task) {
+			total = timings.get(task.key()) + proj.estimate(task.dependencies, inv, memo)
+		}
+		memo[task] = total
+	case S:
+		total = project.estimate(Series(t), inv, memo)
+	case Series:
+		for _, step := range t {
+			total += project.estimate(step, inv, memo)
+		}
+	case P:
+		total = project.estimate(Parallel(t), inv, memo)
+	case Parallel:
+		for _, step := range t {
+			if d := project.estimate(step, inv, memo); d > total {
+				total = d
+			}
+		}
+	}
+	return total
+}
+
+// byCriticalPath orders the steps of a Parallel so the longest ones start
+// first. Steps without previous durations keep their order.
+func (project *Project) byCriticalPath(steps []interface{}, inv *invocation) []interface{} {
+	memo := map[*Task]time.Duration{}
+	costs := make([]time.Duration, len(steps))
+	for i, step := range steps {
+		costs[i] = project.estimate(step, inv, memo)
+	}
+	order := make([]int, len(steps))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return costs[order[a]] > costs[order[b]]
+	})
+	sorted := make([]interface{}, len(steps))
+	for i, j := range order {
+		sorted[i] = steps[j]
+	}
+	return sorted
+}
+
+// taskSpan is when a task ran in an invocation.
+type taskSpan struct {
+	logName string
+	start   time.Time
+	end     time.Time
+}
+
+func (s taskSpan) duration() time.Duration {
+	return s.end.Sub(s.start)
+}
+
+// criticalPath returns the chain of spans which determined when the run
+// finished: the last task to finish, the task which finished last before it
+// started, and so on.
+func criticalPath(spans []taskSpan) []taskSpan {
+	var path []taskSpan
+	var cur *taskSpan
+	for i := range spans {
+		if cur == nil || spans[i].end.After(cur.end) {
+			cur = &spans[i]
+		}
+	}
+	for cur != nil {
+		path = append(path, *cur)
+		var prev *taskSpan
+		for i := range spans {
+			s := &spans[i]
+			if !s.end.After(cur.start) && (prev == nil || s.end.After(prev.end)) {
+				prev = s
+			}
+		}
+		cur = prev
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// idleTimes returns the periods between start and end in which no task ran.
+func idleTimes(spans []taskSpan, start, end time.Time) []taskSpan {
+	sorted := append([]taskSpan(nil), spans...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].start.Before(sorted[j].start)
+	})
+	var idle []taskSpan
+	busyUntil := start
+	for _, s := range sorted {
+		if s.start.Sub(busyUntil) >= idleMin {
+			idle = append(idle, taskSpan{start: busyUntil, end: s.start})
+		}
+		if s.end.After(busyUntil) {
+			busyUntil = s.end
+		}
+	}
+	if end.Sub(busyUntil) >= idleMin {
+		idle = append(idle, taskSpan{start: busyUntil, end: end})
+	}
+	return idle
+}
+
+// printTimings writes a summary of where the time of the run went to w.
+func (inv *invocation) printTimings(w io.Writer) {
+	end := time.Now()
+	inv.mu.Lock()
+	spans := append([]taskSpan(nil), inv.spans...)
+	inv.mu.Unlock()
+
+	fmt.Fprintf(w, "timings: %s wall\n", roundDuration(end.Sub(inv.started)))
+	if len(spans) == 0 {
+		return
+	}
+
+	path := criticalPath(spans)
+	var pathTotal time.Duration
+	names := make([]string, len(path))
+	for i, s := range path {
+		pathTotal += s.duration()
+		names[i] = s.logName
+	}
+	fmt.Fprintf(w, "  critical path (%s): %s\n", roundDuration(pathTotal), strings.Join(names, " -> "))
+
+	sorted := append([]taskSpan(nil), spans...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].duration() > sorted[j].duration()
+	})
+	width := 0
+	for _, s := range sorted {
+		if len(s.logName) > width {
+			width = len(s.logName)
+		}
+	}
+	fmt.Fprintf(w, "  tasks:\n")
+	for _, s := range sorted {
+		fmt.Fprintf(w, "    %-*s  %8s  at +%s\n", width, s.logName, roundDuration(s.duration()), roundDuration(s.start.Sub(inv.started)))
+	}
+
+	idle := idleTimes(spans, inv.started, end)
+	var idleTotal time.Duration
+	for _, s := range idle {
+		idleTotal += s.duration()
+	}
+	fmt.Fprintf(w, "  idle: %s\n", roundDuration(idleTotal))
+	for _, s := range idle {
+		fmt.Fprintf(w, "    +%s to +%s\n", roundDuration(s.start.Sub(inv.started)), roundDuration(s.end.Sub(inv.started)))
+	}
+}
+
+// roundDuration rounds d to be readable in the timing summary.
+func roundDuration(d time.Duration) time.Duration {
+	if d >= time.Second {
+		return d.Round(10 * time.Millisecond)
+	}
+	return d.Round(time.Millisecond)
+}
@@ -0,0 +1,122 @@
+package godo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestCriticalPathFirst(t *testing.T) {
+	resetTimings()
+	timings.set("root:slow", 300*time.Millisecond)
+	timings.set("root:fast", 10*time.Millisecond)
+	timings.set("root:gen", 200*time.Millisecond)
+
+	var mu sync.Mutex
+	started := []string{}
+	record := func(name string) func(*Context) {
+		return func(*Context) {
+			mu.Lock()
+			started = append(started, name)
+			mu.Unlock()
+		}
+	}
+	tasks := func(p *Project) {
+		p.Task1("a", record("a"))
+		p.Task1("b", record("b"))
+		p.Task1("fast", record("fast"))
+		p.Task1("gen", record("gen"))
+		p.Task("slow", S{"gen"}, record("slow"))
+		p.Task("default", P{S{"a", "b"}, "fast", "slow"}, nil)
+	}
+	proj := NewProject(tasks, func(int) {}, nil)
+	inv := newInvocation(nil)
+	steps := proj.byCriticalPath(proj.Tasks["default"].dependencies[0].(P), inv)
+	assert.Equal(t, []interface{}{"slow", "fast", S{"a", "b"}}, steps)
+
+	// unknown durations keep the declared order
+	resetTimings()
+	steps = proj.byCriticalPath(Parallel{"fast", S{"a", "b"}, "slow"}, inv)
+	assert.Equal(t, []interface{}{"fast", S{"a", "b"}, "slow"}, steps)
+
+	assert.NoError(t, proj.runRoot("default", inv))
+	assert.Len(t, started, 5)
+	assert.True(t, timings.get("root:slow") > 0)
+}
+
+func TestTimingSummary(t *testing.T) {
+	start := time.Now().Add(-time.Second)
+	at := func(ms int) time.Time {
+		return start.Add(time.Duration(ms) * time.Millisecond)
+	}
+	spans := []taskSpan{
+		{logName: "default>gen", start: at(0), end: at(100)},
+		{logName: "default>lint", start: at(0), end: at(50)},
+		{logName: "default>compile", start: at(150), end: at(400)},
+		{logName: "default>docs", start: at(160), end: at(200)},
+	}
+	var names []string
+	for _, s := range criticalPath(spans) {
+		names = append(names, s.logName)
+	}
+	assert.Equal(t, []string{"default>gen", "default>compile"}, names)
+
+	idle := idleTimes(spans, start, at(420))
+	assert.Equal(t, []taskSpan{{start: at(100), end: at(150)}, {start: at(400), end: at(420)}}, idle)
+
+	inv := newInvocation(nil)
+	inv.started = start
+	inv.spans = spans
+	var buf bytes.Buffer
+	inv.printTimings(&buf)
+	out := buf.String()
+	assert.Contains(t, out, "critical path (350ms): default>gen -> default>compile")
+	assert.Regexp(t, `default>compile +250ms  at \+150ms`, out)
+	assert.Contains(t, out, "+100ms to +150ms")
+	assert.Contains(t, out, "+400ms to +1s")
+}
+
+func TestTimingsSkipped(t *testing.T) {
+	resetTimings()
+	timings.set("root:once", 300*time.Millisecond)
+	tasks := func(p *Project) {
+		p.Task1("once", func(*Context) {}).RunOnce = true
+	}
+	proj, err := runTask(tasks, "once")
+	assert.NoError(t, err)
+	assert.True(t, timings.get("root:once") < 300*time.Millisecond)
+
+	// a task which does not run keeps its duration
+	timings.set("root:once", 300*time.Millisecond)
+	assert.NoError(t, proj.Run("once"))
+	assert.Equal(t, 300*time.Millisecond, timings.get("root:once"))
+}
+
+func TestTimingsSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godo-timings-save")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tt := &taskTimings{durations: map[string]time.Duration{"root:build": time.Second}}
+	// no Gododir
+	path := filepath.Join(dir, "Gododir", ".godo", "timings.json")
+	assert.NoError(t, tt.save(path))
+	_, err = os.Stat(filepath.Join(dir, "Gododir"))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "Gododir"), 0755))
+	assert.NoError(t, tt.save(path))
+	files, err := ioutil.ReadDir(filepath.Dir(path))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	loaded := &taskTimings{durations: map[string]time.Duration{}}
+	assert.NoError(t, loaded.load(path))
+	assert.Equal(t, tt.durations, loaded.durations)
+}
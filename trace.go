@@ -0,0 +1,265 @@
+package godo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/godo.v2/util"
+	"gopkg.in/godo.v2/watcher"
+)
+
+// tracer records spans of runs, tasks and commands and writes them as a
+// Chrome trace-event file, which can be opened in chrome://tracing or
+// Perfetto. Its methods do nothing on a nil tracer.
+//
+// Each span is on the lane of the branch of the run which started it. The
+// branches of a Parallel run on lanes of their own, so a viewer, which nests
+// the spans of a thread by time, only nests spans which are nested.
+type tracer struct {
+	path    string
+	started time.Time
+	spans   []traceSpan
+	// lanes is the number of lanes in use, free are the lanes of finished
+	// branches
+	lanes int
+	free  []int
+	sync.Mutex
+}
+
+// traceSpan is a span or, if end is zero, an instant event.
+type traceSpan struct {
+	cat   string
+	name  string
+	start time.Time
+	end   time.Time
+	args  M
+	lane  int
+}
+
+// traceEvent is an event of the Chrome trace-event format.
+type traceEvent struct {
+	Name  string  `json:"name"`
+	Cat   string  `json:"cat,omitempty"`
+	Phase string  `json:"ph"`
+	Ts    float64 `json:"ts"`
+	Dur   float64 `json:"dur"`
+	Pid   int     `json:"pid"`
+	Tid   int     `json:"tid"`
+	Scope string  `json:"s,omitempty"`
+	Args  M       `json:"args,omitempty"`
+}
+
+func newTracer(path string) *tracer {
+	return &tracer{path: path, started: time.Now()}
+}
+
+// span records a span on lane from start until now.
+func (t *tracer) span(cat string, name string, start time.Time, lane int, args M) {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.spans = append(t.spans, traceSpan{cat: cat, name: name, start: start, end: time.Now(), args: args, lane: lane})
+}
+
+// instant records an event which happened now.
+func (t *tracer) instant(cat string, name string, args M) {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.spans = append(t.spans, traceSpan{cat: cat, name: name, start: time.Now(), args: args})
+}
+
+// command records the span of an exec'd command which has exited.
+func (t *tracer) command(gcmd *command) {
+	if t == nil {
+		return
+	}
+	start := gcmd.started
+	if start.IsZero() {
+		start = time.Now()
+	}
+	args := M{"exit_code": gcmd.exitCode}
+	if gcmd.wd != "" {
+		args["dir"] = gcmd.wd
+	}
+	if gcmd.signal != "" {
+		args["signal"] = gcmd.signal
+	}
+	span := traceSpan{cat: "exec", name: Mask(gcmd.commandstr), start: start, end: time.Now(), args: args}
+	if gcmd.context != nil && gcmd.context.inv != nil {
+		span.lane = gcmd.context.inv.lane
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.spans = append(t.spans, span)
+}
+
+// newLane returns a lane which is not in use.
+func (t *tracer) newLane() int {
+	if t == nil {
+		return 0
+	}
+	t.Lock()
+	defer t.Unlock()
+	if len(t.free) > 0 {
+		sort.Ints(t.free)
+		lane := t.free[0]
+		t.free = t.free[1:]
+		return lane
+	}
+	t.lanes++
+	return t.lanes
+}
+
+// freeLanes returns lanes which are no longer in use.
+func (t *tracer) freeLanes(lanes ...int) {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.free = append(t.free, lanes...)
+}
+
+// branchLanes are the lanes of the branches of a Parallel. The first
+// branch runs on the lane of the Parallel, the branches which run at the
+// same time get lanes of their own.
+type branchLanes struct {
+	t *tracer
+	// idle are the lanes which are not in use by a branch
+	idle []int
+	// all are the lanes of the Parallel, the first is its own
+	all []int
+	sync.Mutex
+}
+
+func (t *tracer) branchLanes(lane int) *branchLanes {
+	return &branchLanes{t: t, idle: []int{lane}, all: []int{lane}}
+}
+
+// take returns the lane for a branch which starts.
+func (b *branchLanes) take() int {
+	b.Lock()
+	defer b.Unlock()
+	if len(b.idle) == 0 {
+		lane := b.t.newLane()
+		b.all = append(b.all, lane)
+		return lane
+	}
+	sort.Ints(b.idle)
+	lane := b.idle[0]
+	b.idle = b.idle[1:]
+	return lane
+}
+
+// put returns the lane of a branch which finished.
+func (b *branchLanes) put(lane int) {
+	b.Lock()
+	defer b.Unlock()
+	b.idle = append(b.idle, lane)
+}
+
+// close frees the lanes taken for the Parallel once all branches finished.
+func (b *branchLanes) close() {
+	b.t.freeLanes(b.all[1:]...)
+}
+
+// watchEvent records the file event which triggered a watch run.
+func (t *tracer) watchEvent(e *watcher.FileEvent, taskName string) {
+	t.instant("watch", e.String(), M{"path": e.Path, "task": taskName})
+}
+
+// traceArgs returns the args of the span of task.
+func traceArgs(task *Task, err error) M {
+	args := M{"task": task.Name}
+	if err != nil {
+		args["error"] = Mask(err.Error())
+	}
+	return args
+}
+
+// flush writes the trace recorded so far, logging any error.
+func (t *tracer) flush() {
+	if t == nil {
+		return
+	}
+	if err := t.write(); err != nil {
+		util.Error("godo", "could not write trace: %s\n", err.Error())
+	}
+}
+
+// write writes the trace recorded so far to the path of t.
+func (t *tracer) write() error {
+	b, err := json.MarshalIndent(M{
+		"traceEvents":     t.events(),
+		"displayTimeUnit": "ms",
+	}, "", " ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(t.path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(t.path, b, 0644)
+}
+
+// events returns the trace events of the recorded spans. The spans of lane
+// n are on thread n+1, instant events are on thread 0.
+func (t *tracer) events() []traceEvent {
+	t.Lock()
+	spans := append([]traceSpan(nil), t.spans...)
+	t.Unlock()
+
+	sort.SliceStable(spans, func(i, j int) bool {
+		if !spans[i].start.Equal(spans[j].start) {
+			return spans[i].start.Before(spans[j].start)
+		}
+		return spans[i].end.After(spans[j].end)
+	})
+
+	pid := os.Getpid()
+	micros := func(d time.Duration) float64 {
+		return float64(d.Nanoseconds()) / 1e3
+	}
+	events := []traceEvent{
+		{Name: "process_name", Phase: "M", Pid: pid, Args: M{"name": "godo"}},
+		{Name: "thread_name", Phase: "M", Pid: pid, Tid: 0, Args: M{"name": "events"}},
+	}
+	named := map[int]bool{}
+	for _, s := range spans {
+		ts := micros(s.start.Sub(t.started))
+		if s.end.IsZero() {
+			events = append(events, traceEvent{Name: s.name, Cat: s.cat, Phase: "i", Ts: ts, Pid: pid, Tid: 0, Scope: "g", Args: s.args})
+			continue
+		}
+
+		tid := s.lane + 1
+		if !named[tid] {
+			named[tid] = true
+			events = append(events, traceEvent{Name: "thread_name", Phase: "M", Pid: pid, Tid: tid, Args: M{"name": "lane " + strconv.Itoa(tid)}})
+		}
+		events = append(events, traceEvent{
+			Name:  s.name,
+			Cat:   s.cat,
+			Phase: "X",
+			Ts:    ts,
+			Dur:   micros(s.end.Sub(s.start)),
+			Pid:   pid,
+			Tid:   tid,
+			Args:  s.args,
+		})
+	}
+	return events
+}
@@ -0,0 +1,112 @@
+package godo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/godo.v2/watcher"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestTrace(t *testing.T) {
+	if isWindows {
+		return
+	}
+	dir, err := ioutil.TempDir("", "godo-trace")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "trace.json")
+	// lint and test run at the same time
+	var both sync.WaitGroup
+	both.Add(2)
+	tasks := func(p *Project) {
+		p.Task1("lint", func(c *Context) {
+			both.Done()
+			both.Wait()
+			time.Sleep(20 * time.Millisecond)
+		})
+		p.Task1("test", func(c *Context) {
+			both.Done()
+			both.Wait()
+			c.Bash("exit 3")
+		})
+		p.Task("default", P{"lint", "test"}, nil)
+	}
+	resetTimings()
+	proj := NewProject(tasks, func(int) {}, nil)
+	proj.trace = newTracer(path)
+	assert.Error(t, proj.Run("default"))
+	proj.trace.watchEvent(&watcher.FileEvent{Event: watcher.MODIFIED, Path: "main.go"}, "default")
+	assert.NoError(t, proj.trace.write())
+
+	b, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	var trace struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}
+	assert.NoError(t, json.Unmarshal(b, &trace))
+
+	events := map[string]traceEvent{}
+	for _, e := range trace.TraceEvents {
+		if e.Phase != "M" {
+			events[e.Cat+" "+e.Name] = e
+		}
+	}
+	run := events["run default"]
+	parallel := events["parallel parallel"]
+	lint := events["task default>lint"]
+	test := events["task default>test"]
+	exit := events["exec exit 3"]
+	assert.Equal(t, "X", run.Phase)
+	assert.True(t, run.Ts <= parallel.Ts && parallel.Ts+parallel.Dur <= run.Ts+run.Dur)
+	assert.Equal(t, run.Tid, parallel.Tid)
+	assert.NotEqual(t, lint.Tid, test.Tid)
+	assert.Equal(t, "test", test.Args["task"])
+	assert.Contains(t, test.Args["error"], "exit status 3")
+	assert.Equal(t, float64(3), exit.Args["exit_code"])
+	assert.Equal(t, test.Tid, exit.Tid)
+
+	watch := events["watch main.go was modified"]
+	assert.Equal(t, "i", watch.Phase)
+	assert.Equal(t, "main.go", watch.Args["path"])
+}
+
+func TestTraceLanes(t *testing.T) {
+	tr := newTracer("")
+	// a Parallel of three branches of which two run at the same time
+	lanes := tr.branchLanes(0)
+	a := lanes.take()
+	b := lanes.take()
+	lanes.put(a)
+	c := lanes.take()
+	lanes.put(b)
+	lanes.put(c)
+	lanes.close()
+	assert.Equal(t, []int{0, 1, 0}, []int{a, b, c})
+	// the lanes of a finished Parallel are reused
+	assert.Equal(t, 1, tr.newLane())
+	assert.Equal(t, 2, tr.newLane())
+
+	at := func(ms int) time.Time {
+		return tr.started.Add(time.Duration(ms) * time.Millisecond)
+	}
+	tr.spans = []traceSpan{
+		{cat: "run", name: "default", start: at(0), end: at(100)},
+		{cat: "task", name: "a", start: at(5), end: at(90)},
+		{cat: "task", name: "b", start: at(10), end: at(50), lane: 1},
+		{cat: "exec", name: "go vet", start: at(20), end: at(30), lane: 1},
+		{cat: "watch", name: "main.go was modified", start: at(40)},
+	}
+	tids := map[string]int{}
+	for _, e := range tr.events() {
+		if e.Phase != "M" {
+			tids[e.Name] = e.Tid
+		}
+	}
+	assert.Equal(t, map[string]int{"default": 1, "a": 1, "b": 2, "go vet": 2, "main.go was modified": 0}, tids)
+}
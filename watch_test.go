@@ -1,10 +1,12 @@
 package godo
 
 import (
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"gopkg.in/godo.v2/watcher"
 	"gopkg.in/stretchr/testify.v1/assert"
 )
 
@@ -253,3 +255,92 @@ func TestOutdated(t *testing.T) {
 
 	assert.Equal(t, "TPP", ran)
 }
+
+func TestWatchInvalidatesAffectedBranch(t *testing.T) {
+	tasks := func(p *Project) {
+		p.Task("compile", nil, func(*Context) {})
+		p.Task("styles", nil, func(*Context) {}).Src("test/styles/*scss")
+		p.Task("templates", nil, func(*Context) {}).Src("test/templates/*go.html")
+		p.Task("other", S{"styles"}, func(*Context) {}).Src("test/styles/*.css")
+		p.Task("default", S{"templates", "other", "compile"}, nil)
+	}
+	proj := NewProject(tasks, nil, nil)
+
+	path, _ := filepath.Abs("test/templates/1.go.html")
+	inv := proj.newWatchInvocation("default", &watcher.FileEvent{Path: path})
+
+	assert.True(t, inv.includes(proj.Tasks["templates"]))
+	assert.True(t, inv.includes(proj.Tasks["compile"]))
+	assert.True(t, inv.includes(proj.Tasks["default"]))
+	assert.False(t, inv.includes(proj.Tasks["styles"]))
+	assert.False(t, inv.includes(proj.Tasks["other"]))
+}
+
+func TestWatchCancelSkipsPendingTasks(t *testing.T) {
+	trace := ""
+	var inv *invocation
+	tasks := func(p *Project) {
+		p.Task("A", nil, func(*Context) {
+			trace += "A"
+			inv.cancel()
+		})
+		p.Task("B", nil, func(*Context) {
+			trace += "B"
+		})
+		p.Task("default", S{"A", "B"}, nil)
+	}
+	proj := NewProject(tasks, nil, nil)
+
+	inv = newInvocation(nil)
+	err := proj.run("default", "default", inv)
+	assert.Equal(t, errRunCancelled, err)
+	assert.Equal(t, "A", trace)
+}
+
+func TestWatchInvalidateConcurrent(t *testing.T) {
+	tasks := func(p *Project) {
+		p.Task1("lint", func(*Context) {}).Src("test/*.txt")
+		p.TaskD("a", S{"lint"})
+		p.TaskD("b", S{"lint"})
+	}
+	proj := NewProject(tasks, func(int) {}, nil)
+	lint := proj.Tasks["lint"]
+
+	e := &watcher.FileEvent{Event: watcher.MODIFIED, Path: filepath.Join(wd, "test", "foo.txt")}
+	invs := make(chan *invocation, 2)
+	for _, name := range []string{"a", "b"} {
+		go func(name string) {
+			invs <- proj.newWatchInvocation(name, e)
+		}(name)
+	}
+	for i := 0; i < 2; i++ {
+		assert.True(t, (<-invs).invalid[lint])
+	}
+}
+
+func TestWatchDebounceResubmits(t *testing.T) {
+	ran := 0
+	tasks := func(p *Project) {
+		p.Task1("build", func(*Context) { ran++ }).Debounce(20 * time.Millisecond)
+	}
+	proj := NewProject(tasks, func(int) {}, nil)
+
+	e := &watcher.FileEvent{Event: watcher.MODIFIED, Path: "main.go"}
+	resubmitted := make(chan *watcher.FileEvent, 1)
+	for i := 0; i < 2; i++ {
+		inv := proj.newWatchInvocation("build", e)
+		inv.resubmit = func(e *watcher.FileEvent) {
+			resubmitted <- e
+		}
+		assert.NoError(t, proj.run("build", "build", inv))
+	}
+	assert.Equal(t, 1, ran)
+
+	select {
+	case got := <-resubmitted:
+		assert.Equal(t, e, got)
+	case <-time.After(time.Second):
+		t.Fatal("debounced run was not resubmitted")
+	}
+	assert.Equal(t, 1, ran)
+}